@@ -0,0 +1,196 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types reported in SopsSecretStatus.Conditions.
+const (
+	// ConditionReady is True when the payload was decrypted and every target Secret is in sync.
+	ConditionReady = "Ready"
+	// ConditionDecrypted is True when the encrypted payload could be decrypted, parsed and rendered.
+	ConditionDecrypted = "Decrypted"
+	// ConditionSynced is True when every target Secret matches the decrypted payload.
+	ConditionSynced = "Synced"
+)
+
+// Condition reasons reported in SopsSecretStatus.Conditions.
+const (
+	ReasonReconciled      = "Reconciled"
+	ReasonDecryptFailed   = "DecryptFailed"
+	ReasonInvalidPayload  = "InvalidPayload"
+	ReasonTemplateFailed  = "TemplateFailed"
+	ReasonSyncFailed      = "SyncFailed"
+	ReasonDeleteFailed    = "DeleteFailed"
+	ReasonKeyUnavailable  = "KeyUnavailable"
+	ReasonTargetDenied    = "TargetDenied"
+	ReasonRecipientDenied = "RecipientDenied"
+	ReasonUnencrypted     = "Unencrypted"
+)
+
+// Deletion policies of SopsSecretSpec.DeletionPolicy.
+const (
+	// DeletionPolicyDelete deletes the generated Secrets along with the SopsSecret.
+	DeletionPolicyDelete = "Delete"
+	// DeletionPolicyRetain keeps the generated Secrets when the SopsSecret is deleted.
+	DeletionPolicyRetain = "Retain"
+)
+
+// SopsSecretTargetStatus is the observed state of a single generated Secret
+type SopsSecretTargetStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Synced    bool   `json:"synced"`
+	// Message explains why the target is not synced, or not deleted while the SopsSecret is being deleted.
+	Message string `json:"message,omitempty"`
+	// Deleted is true once the target was deleted while the SopsSecret is being deleted.
+	// +optional
+	Deleted bool `json:"deleted,omitempty"`
+	// Denied is true when the target policy doesn't allow the SopsSecret to write the target.
+	// +optional
+	Denied bool `json:"denied,omitempty"`
+}
+
+// SopsSecretTargetReference identifies a generated Secret
+type SopsSecretTargetReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// SopsSecretStatus defines the observed state of SopsSecret
+type SopsSecretStatus struct {
+	// ObservedGeneration is the generation last processed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncTime is the last time every target Secret was successfully synced.
+	LastSyncTime *metav1.Time             `json:"lastSyncTime,omitempty"`
+	Conditions   []metav1.Condition       `json:"conditions,omitempty"`
+	Targets      []SopsSecretTargetStatus `json:"targets,omitempty"`
+	// PrunedTargets lists the Secrets deleted since the last change of the spec
+	// because they were no longer a target, e.g. after the template name changed.
+	// +optional
+	PrunedTargets []SopsSecretTargetReference `json:"prunedTargets,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Last Sync",type="date",JSONPath=".status.lastSyncTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// SopsSecret is the Schema for the sopssecrets API
+type SopsSecret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SopsSecretSpec   `json:"spec,omitempty"`
+	Status SopsSecretStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SopsSecretList contains a list of SopsSecret
+type SopsSecretList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SopsSecret `json:"items"`
+}
+
+// SopsSecretSpec defines the desired state of SopsSecret
+type SopsSecretSpec struct {
+	// Type is the type of the generated Secrets.
+	Type corev1.SecretType `json:"type,omitempty"`
+	// EncryptedData is the sops encrypted document holding the data of the generated Secrets.
+	// Decrypted values starting with "sops-converter/base64:" are base64 decoded into raw bytes, whoever wrote them:
+	// a value written by hand must not start with the marker, it is decoded too or fails the reconcile when not base64.
+	EncryptedData string `json:"encryptedData,omitempty"`
+
+	Template    SopsSecretTemplate `json:"template,omitempty"`
+	IgnoredKeys []string           `json:"ignoredKeys,omitempty"`
+
+	// DeletionPolicy controls whether the generated Secrets are deleted with the SopsSecret, Delete when unset.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// SkipFinalizers retains the generated Secrets when DeletionPolicy is unset.
+	// Deprecated: set DeletionPolicy to Retain instead.
+	// +optional
+	SkipFinalizers bool `json:"skipFinalizers,omitempty"`
+
+	// ValueEncoding controls how nested values of the decrypted data are stored.
+	// "json" and "yaml" serialize them, "flatten" stores one key per leaf with the keys joined by dots.
+	// Nested values are rejected when unset.
+	// +kubebuilder:validation:Enum=json;yaml;flatten
+	// +optional
+	ValueEncoding string `json:"valueEncoding,omitempty"`
+
+	// Format is the sops format of the encrypted data, yaml when unset.
+	// +kubebuilder:validation:Enum=yaml;json;dotenv;ini;binary
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// BinaryKey is the Secret key holding the whole plaintext in the binary format.
+	// +optional
+	BinaryKey string `json:"binaryKey,omitempty"`
+
+	// DecryptionKeyRef points to a Secret in the namespace of the SopsSecret holding the age or PGP private keys
+	// the encrypted data is decrypted with, instead of the keys of the controller.
+	// +optional
+	DecryptionKeyRef *SopsSecretKeyReference `json:"decryptionKeyRef,omitempty"`
+
+	// AllowUnencrypted accepts encrypted data without sops metadata, with plaintext values
+	// or with metadata exempting every value from encryption, only meant for tests.
+	// +optional
+	AllowUnencrypted bool `json:"allowUnencrypted,omitempty"`
+}
+
+// SopsSecretKeyReference selects the private keys of a Secret
+type SopsSecretKeyReference struct {
+	// Name of the Secret, in the namespace of the SopsSecret.
+	Name string `json:"name"`
+	// Key of the Secret holding the private keys, every key of the Secret is used when unset.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+type SopsSecretTemplate struct {
+	SopsSecretTemplateMetadata `json:"metadata,omitempty"`
+
+	// Data maps Secret keys to Go text/template strings rendered against the decrypted values.
+	// Rendered keys are added to the decrypted keys, replacing the ones with the same name.
+	// +optional
+	Data map[string]string `json:"data,omitempty"`
+}
+
+type SopsSecretTemplateMetadata struct {
+	Name       string   `json:"name,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects additional target namespaces by label.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SopsSecret{}, &SopsSecretList{})
+}
@@ -0,0 +1,335 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+	"github.com/dhouti/sops-converter/pkg/secretdata"
+)
+
+// requiredSecretKeys are the keys the API server requires for the built-in secret types.
+var requiredSecretKeys = map[corev1.SecretType][]string{
+	corev1.SecretTypeTLS:              {corev1.TLSCertKey, corev1.TLSPrivateKeyKey},
+	corev1.SecretTypeDockerConfigJson: {corev1.DockerConfigJsonKey},
+	corev1.SecretTypeDockercfg:        {corev1.DockerConfigKey},
+	corev1.SecretTypeSSHAuth:          {corev1.SSHAuthPrivateKey},
+}
+
+// redacted stands in for values that must not be echoed back in admission errors.
+type redacted struct{}
+
+func (redacted) String() string {
+	return "<redacted>"
+}
+
+// AllowedRecipientsAnnotation on a namespace lists the master keys, comma or whitespace separated,
+// the SopsSecrets of the namespace may be encrypted to. Every master key is allowed without it.
+const AllowedRecipientsAnnotation = "secrets.dhouti.dev/allowed-recipients"
+
+// RequireDecryptionKeyRefAnnotation set to "true" on a namespace makes spec.decryptionKeyRef mandatory
+// for the SopsSecrets of the namespace, so they are never decrypted with the keys of the controller.
+const RequireDecryptionKeyRefAnnotation = "secrets.dhouti.dev/require-decryption-key-ref"
+
+func (r *SopsSecret) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&sopsSecretValidator{reader: mgr.GetAPIReader()}).
+		Complete()
+}
+
+// DisallowedRecipients returns the master keys of the encrypted data that AllowedRecipientsAnnotation,
+// in the annotations of the namespace of r, doesn't list.
+func (r *SopsSecret) DisallowedRecipients(namespaceAnnotations map[string]string) ([]string, error) {
+	allowed, ok := namespaceAnnotations[AllowedRecipientsAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	format := r.Spec.Format
+	if format == "" {
+		format = decrypt.FormatYAML
+	}
+	metadata, _, err := decrypt.ParseMetadata([]byte(r.Spec.EncryptedData), format)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.DisallowedRecipients(strings.FieldsFunc(allowed, func(c rune) bool {
+		return c == ',' || unicode.IsSpace(c)
+	})), nil
+}
+
+// MissingDecryptionKeyRef reports whether RequireDecryptionKeyRefAnnotation, in the annotations of the namespace of r,
+// requires spec.decryptionKeyRef while r has none.
+func (r *SopsSecret) MissingDecryptionKeyRef(namespaceAnnotations map[string]string) bool {
+	required, _ := strconv.ParseBool(namespaceAnnotations[RequireDecryptionKeyRefAnnotation])
+	return required && r.Spec.DecryptionKeyRef == nil
+}
+
+// +kubebuilder:webhook:path=/validate-secrets-dhouti-dev-v1-sopssecret,mutating=false,failurePolicy=fail,sideEffects=None,groups=secrets.dhouti.dev,resources=sopssecrets,verbs=create;update,versions=v1,name=vsopssecret.secrets.dhouti.dev,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &sopsSecretValidator{}
+
+// sopsSecretValidator runs the checks of SopsSecret.validate, and the ones needing the namespace of the object.
+type sopsSecretValidator struct {
+	reader client.Reader
+}
+
+func (v *sopsSecretValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	r := obj.(*SopsSecret)
+	return r.validate(v.validateNamespace(ctx, r)...)
+}
+
+func (v *sopsSecretValidator) ValidateUpdate(ctx context.Context, oldObj, obj runtime.Object) error {
+	r := obj.(*SopsSecret)
+	if skipUpdateValidation(oldObj.(*SopsSecret), r) {
+		return nil
+	}
+	return r.validate(v.validateNamespace(ctx, r)...)
+}
+
+func (v *sopsSecretValidator) ValidateDelete(_ context.Context, _ runtime.Object) error {
+	return nil
+}
+
+// validateNamespace checks the encrypted data only has master keys the namespace allows,
+// and that spec.decryptionKeyRef is set when the namespace requires it.
+func (v *sopsSecretValidator) validateNamespace(ctx context.Context, r *SopsSecret) field.ErrorList {
+	namespace := &corev1.Namespace{}
+	if err := v.reader.Get(ctx, types.NamespacedName{Name: r.Namespace}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return field.ErrorList{field.InternalError(field.NewPath("metadata", "namespace"), err)}
+	}
+
+	var allErrs field.ErrorList
+	if r.MissingDecryptionKeyRef(namespace.Annotations) {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec", "decryptionKeyRef"),
+			fmt.Sprintf("namespace %s requires the SopsSecrets to use their own decryption keys", r.Namespace)))
+	}
+	disallowed, err := r.DisallowedRecipients(namespace.Annotations)
+	if err != nil || len(disallowed) == 0 {
+		// Metadata that doesn't parse is reported by validateData
+		return allErrs
+	}
+	return append(allErrs, field.Forbidden(field.NewPath("spec", "encryptedData", "sops"),
+		fmt.Sprintf("master keys not allowed in namespace %s: %s", r.Namespace, strings.Join(disallowed, ", "))))
+}
+
+// skipUpdateValidation reports whether an update leaves the spec alone or targets an object being deleted, e.g. when
+// the controller adds or removes its finalizer. Objects stored before a check existed, or in a namespace that later restricted
+// its recipients, must stay updatable so they can be deleted.
+func skipUpdateValidation(old, r *SopsSecret) bool {
+	return r.GetDeletionTimestamp() != nil || equality.Semantic.DeepEqual(old.Spec, r.Spec)
+}
+
+// validate checks everything that can be checked without the decryption keys, on top of errs.
+func (r *SopsSecret) validate(errs ...*field.Error) error {
+	allErrs := field.ErrorList(errs)
+	allErrs = append(allErrs, r.validateType()...)
+	allErrs = append(allErrs, r.validateData()...)
+	allErrs = append(allErrs, r.validateTemplate()...)
+
+	for i, key := range r.Spec.IgnoredKeys {
+		for _, msg := range validation.IsConfigMapKey(key) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "ignoredKeys").Index(i), key, msg))
+		}
+	}
+
+	if ref := r.Spec.DecryptionKeyRef; ref != nil {
+		refPath := field.NewPath("spec", "decryptionKeyRef")
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(refPath.Child("name"), ""))
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+			allErrs = append(allErrs, field.Invalid(refPath.Child("name"), ref.Name, msg))
+		}
+		if ref.Key != "" {
+			for _, msg := range validation.IsConfigMapKey(ref.Key) {
+				allErrs = append(allErrs, field.Invalid(refPath.Child("key"), ref.Key, msg))
+			}
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("SopsSecret").GroupKind(), r.Name, allErrs)
+}
+
+func (r *SopsSecret) validateType() field.ErrorList {
+	if r.Spec.Type == "" {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsQualifiedName(string(r.Spec.Type)) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "type"), r.Spec.Type, msg))
+	}
+	if r.Spec.Type == corev1.SecretTypeServiceAccountToken {
+		if _, ok := r.Spec.Template.Annotations[corev1.ServiceAccountNameKey]; !ok {
+			allErrs = append(allErrs, field.Required(
+				field.NewPath("spec", "template", "metadata", "annotations").Key(corev1.ServiceAccountNameKey),
+				"required for secrets of type "+string(r.Spec.Type)))
+		}
+	}
+	return allErrs
+}
+
+func (r *SopsSecret) validateData() field.ErrorList {
+	dataPath := field.NewPath("spec", "encryptedData")
+	if strings.TrimSpace(r.Spec.EncryptedData) == "" {
+		return field.ErrorList{field.Required(dataPath, "must be a sops encrypted document")}
+	}
+
+	format := r.Spec.Format
+	if format == "" {
+		format = decrypt.FormatYAML
+	}
+	var allErrs field.ErrorList
+	metadata, keys, err := decrypt.ParseMetadata([]byte(r.Spec.EncryptedData), format)
+	switch {
+	case err == nil && r.Spec.AllowUnencrypted:
+	case err == nil:
+		if err = metadata.Validate(); err != nil {
+			allErrs = append(allErrs, field.Invalid(dataPath.Child("sops"), redacted{}, err.Error()))
+		}
+		paths, encrypted, _ := decrypt.PlaintextValues([]byte(r.Spec.EncryptedData), format)
+		for _, path := range paths {
+			allErrs = append(allErrs, field.Forbidden(dataPath.Key(path), "value is not encrypted, see spec.allowUnencrypted"))
+		}
+		if len(paths) == 0 && encrypted == 0 {
+			allErrs = append(allErrs, field.Forbidden(dataPath, decrypt.ErrNothingEncrypted.Error()+", see spec.allowUnencrypted"))
+		}
+	case r.Spec.AllowUnencrypted:
+		// The sops metadata is optional too
+		if keys, err = decrypt.DocumentKeys([]byte(r.Spec.EncryptedData), format); err != nil {
+			return field.ErrorList{field.Invalid(dataPath, redacted{}, err.Error())}
+		}
+	default:
+		return field.ErrorList{field.Invalid(dataPath, redacted{}, err.Error())}
+	}
+
+	binaryKeyPath := field.NewPath("spec", "binaryKey")
+	present := make(map[string]bool)
+	switch format {
+	case decrypt.FormatBinary:
+		// The whole plaintext is stored under a single key
+		if r.Spec.BinaryKey == "" {
+			allErrs = append(allErrs, field.Required(binaryKeyPath, "required by the binary format"))
+			break
+		}
+		for _, msg := range validation.IsConfigMapKey(r.Spec.BinaryKey) {
+			allErrs = append(allErrs, field.Invalid(binaryKeyPath, r.Spec.BinaryKey, msg))
+		}
+		present[r.Spec.BinaryKey] = true
+		keys = nil
+	case decrypt.FormatINI:
+		// Sections turn into keys depending on the value encoding, the type can't be checked
+		return allErrs
+	default:
+		if r.Spec.BinaryKey != "" {
+			allErrs = append(allErrs, field.Forbidden(binaryKeyPath, "only used by the binary format"))
+		}
+	}
+
+	for _, key := range keys {
+		present[key] = true
+		for _, msg := range validation.IsConfigMapKey(key) {
+			allErrs = append(allErrs, field.Invalid(dataPath.Key(key), key, msg))
+		}
+	}
+
+	// Ignored keys are copied from the live secret
+	for _, key := range r.Spec.IgnoredKeys {
+		present[key] = true
+	}
+	for key := range r.Spec.Template.Data {
+		present[key] = true
+	}
+	for _, key := range requiredSecretKeys[r.Spec.Type] {
+		if !present[key] {
+			allErrs = append(allErrs, field.Required(dataPath.Key(key), "required for secrets of type "+string(r.Spec.Type)))
+		}
+	}
+	if r.Spec.Type == corev1.SecretTypeBasicAuth && !present[corev1.BasicAuthUsernameKey] && !present[corev1.BasicAuthPasswordKey] {
+		allErrs = append(allErrs, field.Required(dataPath.Key(corev1.BasicAuthUsernameKey),
+			"username or password required for secrets of type "+string(r.Spec.Type)))
+	}
+	return allErrs
+}
+
+func (r *SopsSecret) validateTemplate() field.ErrorList {
+	var allErrs field.ErrorList
+	metadataPath := field.NewPath("spec", "template", "metadata")
+	template := r.Spec.Template
+
+	if template.Name != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(template.Name) {
+			allErrs = append(allErrs, field.Invalid(metadataPath.Child("name"), template.Name, msg))
+		}
+	}
+	for i, namespace := range template.Namespaces {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			allErrs = append(allErrs, field.Invalid(metadataPath.Child("namespaces").Index(i), namespace, msg))
+		}
+	}
+	if template.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(template.NamespaceSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(metadataPath.Child("namespaceSelector"), template.NamespaceSelector, err.Error()))
+		}
+	}
+	for key, value := range template.Labels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			allErrs = append(allErrs, field.Invalid(metadataPath.Child("labels").Key(key), key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			allErrs = append(allErrs, field.Invalid(metadataPath.Child("labels").Key(key), value, msg))
+		}
+	}
+	// Checked here so an invalid key is rejected instead of failing every write of the target Secrets
+	allErrs = append(allErrs, apivalidation.ValidateAnnotations(template.Annotations, metadataPath.Child("annotations"))...)
+
+	dataPath := field.NewPath("spec", "template", "data")
+	for key, text := range template.Data {
+		for _, msg := range validation.IsConfigMapKey(key) {
+			allErrs = append(allErrs, field.Invalid(dataPath.Key(key), key, msg))
+		}
+		if _, err := secretdata.ParseTemplate(key, text); err != nil {
+			allErrs = append(allErrs, field.Invalid(dataPath.Key(key), text, err.Error()))
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,304 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+	secretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
+)
+
+// encryptedData returns a sops document with the given top level keys, the values are never decrypted.
+func encryptedData(keys ...string) string {
+	data := ""
+	for _, key := range keys {
+		data += fmt.Sprintf("%s: ENC[AES256_GCM,data:c2VjcmV0,iv:aXY=,tag:dGFn,type:str]\n", key)
+	}
+	return data + `sops:
+    age:
+        - recipient: age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+          enc: |
+            -----BEGIN AGE ENCRYPTED FILE-----
+            -----END AGE ENCRYPTED FILE-----
+    lastmodified: "2021-01-01T00:00:00Z"
+    mac: ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]
+    version: 3.7.1
+`
+}
+
+var _ = Describe("SopsSecret webhook", func() {
+	ctx := context.Background()
+
+	newSopsSecret := func() *secretsv1.SopsSecret {
+		return &secretsv1.SopsSecret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-" + rand.String(8),
+				Namespace: "default",
+			},
+			Spec: secretsv1.SopsSecretSpec{
+				EncryptedData: encryptedData("username", "password"),
+			},
+		}
+	}
+
+	expectInvalid := func(obj *secretsv1.SopsSecret, substring string) {
+		err := k8sClient.Create(ctx, obj)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected an invalid error, got %v", err)
+		Expect(err.Error()).To(ContainSubstring(substring))
+	}
+
+	It("admits a valid SopsSecret", func() {
+		obj := newSopsSecret()
+		obj.Spec.Template.Namespaces = []string{"default", "kube-system"}
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+
+		obj.Spec.IgnoredKeys = []string{"username"}
+		Expect(k8sClient.Update(ctx, obj)).To(Succeed())
+	})
+
+	It("rejects data that isn't yaml", func() {
+		obj := newSopsSecret()
+		obj.Spec.EncryptedData = "{not yaml"
+		expectInvalid(obj, "spec.encryptedData")
+	})
+
+	It("rejects data without sops metadata", func() {
+		obj := newSopsSecret()
+		obj.Spec.EncryptedData = "password: hunter2\n"
+		expectInvalid(obj, "sops metadata not found")
+		Expect(k8sClient.Create(ctx, obj).Error()).ToNot(ContainSubstring("hunter2"))
+	})
+
+	It("rejects values that aren't encrypted", func() {
+		obj := newSopsSecret()
+		obj.Spec.EncryptedData = "token: hunter2\n" + encryptedData("password")
+		expectInvalid(obj, "spec.encryptedData[token]")
+		Expect(k8sClient.Create(ctx, obj).Error()).ToNot(ContainSubstring("hunter2"))
+	})
+
+	It("rejects sops metadata exempting every value", func() {
+		obj := newSopsSecret()
+		obj.Spec.EncryptedData = "password: hunter2\n" + encryptedData() + "    unencrypted_regex: .*\n"
+		expectInvalid(obj, "no value is encrypted")
+		Expect(k8sClient.Create(ctx, obj).Error()).ToNot(ContainSubstring("hunter2"))
+	})
+
+	It("admits plaintext data with allowUnencrypted", func() {
+		obj := newSopsSecret()
+		obj.Spec.EncryptedData = "password: hunter2\n"
+		obj.Spec.AllowUnencrypted = true
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+	})
+
+	It("rejects sops metadata without master keys", func() {
+		obj := newSopsSecret()
+		obj.Spec.EncryptedData = "password: ENC[AES256_GCM,data:c2VjcmV0,iv:aXY=,tag:dGFn,type:str]\nsops:\n    lastmodified: \"2021-01-01T00:00:00Z\"\n"
+		expectInvalid(obj, "No keys found")
+	})
+
+	It("rejects invalid secret keys", func() {
+		obj := newSopsSecret()
+		obj.Spec.EncryptedData = encryptedData("not/valid")
+		expectInvalid(obj, "spec.encryptedData[not/valid]")
+	})
+
+	It("rejects an invalid type", func() {
+		obj := newSopsSecret()
+		obj.Spec.Type = "not a type"
+		expectInvalid(obj, "spec.type")
+	})
+
+	It("rejects types missing their required keys", func() {
+		obj := newSopsSecret()
+		obj.Spec.Type = corev1.SecretTypeTLS
+		obj.Spec.EncryptedData = encryptedData("tls.crt")
+		expectInvalid(obj, "spec.encryptedData[tls.key]")
+	})
+
+	It("counts ignored keys towards the required keys", func() {
+		obj := newSopsSecret()
+		obj.Spec.Type = corev1.SecretTypeTLS
+		obj.Spec.EncryptedData = encryptedData("tls.crt")
+		obj.Spec.IgnoredKeys = []string{"tls.key"}
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+	})
+
+	It("reads the metadata of dotenv documents", func() {
+		obj := newSopsSecret()
+		obj.Spec.Format = "dotenv"
+		obj.Spec.EncryptedData = "PASSWORD=ENC[AES256_GCM,data:c2VjcmV0,iv:aXY=,tag:dGFn,type:str]\n" +
+			"sops_age__list_0__map_recipient=age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p\n" +
+			"sops_lastmodified=2021-01-01T00:00:00Z\n" +
+			"sops_mac=ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]\n"
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+	})
+
+	It("requires a binary key for the binary format", func() {
+		obj := newSopsSecret()
+		obj.Spec.Format = "binary"
+		// sops writes binary documents as json
+		obj.Spec.EncryptedData = `{"data": "ENC[AES256_GCM,data:c2VjcmV0,iv:aXY=,tag:dGFn,type:str]", "sops": {` +
+			`"age": [{"recipient": "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p", "enc": ""}], ` +
+			`"lastmodified": "2021-01-01T00:00:00Z", "mac": "ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]", "version": "3.7.1"}}`
+		expectInvalid(obj, "spec.binaryKey")
+	})
+
+	It("rejects invalid template namespaces", func() {
+		obj := newSopsSecret()
+		obj.Spec.Template.Namespaces = []string{"Not_A_Namespace"}
+		expectInvalid(obj, "spec.template.metadata.namespaces[0]")
+	})
+
+	It("rejects invalid template annotation keys", func() {
+		obj := newSopsSecret()
+		obj.Spec.Template.Annotations = map[string]string{"not a key": "value"}
+		expectInvalid(obj, "spec.template.metadata.annotations")
+	})
+
+	It("rejects template data that doesn't parse", func() {
+		obj := newSopsSecret()
+		obj.Spec.Template.Data = map[string]string{"url": "{{ .user "}
+		expectInvalid(obj, "spec.template.data[url]")
+	})
+
+	It("rejects an invalid decryption key reference", func() {
+		obj := newSopsSecret()
+		obj.Spec.DecryptionKeyRef = &secretsv1.SopsSecretKeyReference{Name: "team-keys", Key: "not/a/key"}
+		expectInvalid(obj, "spec.decryptionKeyRef.key")
+	})
+
+	It("rejects master keys the namespace doesn't allow", func() {
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "restricted-" + rand.String(8),
+			Annotations: map[string]string{secretsv1.AllowedRecipientsAnnotation: "age1other, arn:aws:kms:eu-west-1:111111111111:key/prod"},
+		}}
+		Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+		obj := newSopsSecret()
+		obj.Namespace = namespace.Name
+		expectInvalid(obj, "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p")
+
+		namespace.Annotations[secretsv1.AllowedRecipientsAnnotation] += "\nage1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+		Expect(k8sClient.Update(ctx, namespace)).To(Succeed())
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+	})
+
+	It("requires a decryption key reference when the namespace does", func() {
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "restricted-" + rand.String(8),
+			Annotations: map[string]string{secretsv1.RequireDecryptionKeyRefAnnotation: "true"},
+		}}
+		Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+		obj := newSopsSecret()
+		obj.Namespace = namespace.Name
+		expectInvalid(obj, "spec.decryptionKeyRef")
+
+		obj.Spec.DecryptionKeyRef = &secretsv1.SopsSecretKeyReference{Name: "team-keys"}
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+	})
+
+	It("admits updates that leave the spec alone, and updates of objects being deleted", func() {
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "restricted-" + rand.String(8)}}
+		Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+		obj := newSopsSecret()
+		obj.Namespace = namespace.Name
+		obj.Finalizers = []string{"secrets.dhouti.dev/test"}
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+
+		// The stored object no longer passes validation
+		namespace.Annotations = map[string]string{secretsv1.AllowedRecipientsAnnotation: "age1other"}
+		Expect(k8sClient.Update(ctx, namespace)).To(Succeed())
+
+		obj.Labels = map[string]string{"updated": "true"}
+		Expect(k8sClient.Update(ctx, obj)).To(Succeed())
+
+		changed := obj.DeepCopy()
+		changed.Spec.IgnoredKeys = []string{"username"}
+		err := k8sClient.Update(ctx, changed)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "expected an invalid error, got %v", err)
+
+		Expect(k8sClient.Delete(ctx, obj)).To(Succeed())
+		deleting := &secretsv1.SopsSecret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}, deleting)).To(Succeed())
+		deleting.Finalizers = nil
+		Expect(k8sClient.Update(ctx, deleting)).To(Succeed())
+	})
+
+	It("counts template data towards the required keys", func() {
+		obj := newSopsSecret()
+		obj.Spec.Type = corev1.SecretTypeTLS
+		obj.Spec.EncryptedData = encryptedData("tls.crt")
+		obj.Spec.Template.Data = map[string]string{"tls.key": "{{ .key }}"}
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+	})
+})
+
+var _ = Describe("SopsSecret conversion", func() {
+	ctx := context.Background()
+
+	It("serves v1beta1 objects as v1", func() {
+		name := "test-" + rand.String(8)
+		legacy := &secretsv1beta1.SopsSecret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: encryptedData("username"),
+		}
+		legacy.Spec.IgnoredKeys = []string{"password"}
+		Expect(k8sClient.Create(ctx, legacy)).To(Succeed())
+
+		obj := &secretsv1.SopsSecret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, obj)).To(Succeed())
+		Expect(obj.Spec.Type).To(Equal(corev1.SecretTypeOpaque))
+		Expect(obj.Spec.EncryptedData).To(Equal(legacy.Data))
+		Expect(obj.Spec.IgnoredKeys).To(Equal([]string{"password"}))
+	})
+
+	It("serves v1 objects as v1beta1", func() {
+		name := "test-" + rand.String(8)
+		obj := &secretsv1.SopsSecret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: secretsv1.SopsSecretSpec{
+				Type:          corev1.SecretTypeOpaque,
+				EncryptedData: encryptedData("username"),
+			},
+		}
+		Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+
+		legacy := &secretsv1beta1.SopsSecret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, legacy)).To(Succeed())
+		Expect(legacy.Type).To(Equal(corev1.SecretTypeOpaque))
+		Expect(legacy.Data).To(Equal(obj.Spec.EncryptedData))
+	})
+})
@@ -0,0 +1,71 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SopsSecretPolicySpec grants the SopsSecrets of the source namespaces the right to write Secrets to other namespaces
+type SopsSecretPolicySpec struct {
+	// SourceNamespaces are the namespaces of the SopsSecrets the policy applies to, "*" matches every namespace.
+	// +optional
+	SourceNamespaces []string `json:"sourceNamespaces,omitempty"`
+	// SourceNamespaceSelector selects additional source namespaces by label.
+	// +optional
+	SourceNamespaceSelector *metav1.LabelSelector `json:"sourceNamespaceSelector,omitempty"`
+
+	// Targets are the Secrets the SopsSecrets of the source namespaces may write.
+	Targets []SopsSecretPolicyTarget `json:"targets"`
+}
+
+// SopsSecretPolicyTarget selects Secrets by namespace and name
+type SopsSecretPolicyTarget struct {
+	// Namespaces are the target namespaces, "*" matches every namespace.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects additional target namespaces by label.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Names are shell patterns matching the Secret names, e.g. "app-*", every name matches when empty.
+	// +optional
+	Names []string `json:"names,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// SopsSecretPolicy allows SopsSecrets to write Secrets outside of their own namespace when -enforce-target-policy is set
+type SopsSecretPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SopsSecretPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SopsSecretPolicyList contains a list of SopsSecretPolicy
+type SopsSecretPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SopsSecretPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SopsSecretPolicy{}, &SopsSecretPolicyList{})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/dhouti/sops-converter/api/v1"
+)
+
+var _ conversion.Convertible = &SopsSecret{}
+
+// ConvertTo converts this SopsSecret to the Hub version (v1).
+func (src *SopsSecret) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.SopsSecret)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Spec.Type = src.Type
+	dst.Spec.EncryptedData = src.Data
+	dst.Spec.IgnoredKeys = src.Spec.IgnoredKeys
+	dst.Spec.DeletionPolicy = src.Spec.DeletionPolicy
+	dst.Spec.SkipFinalizers = src.Spec.SkipFinalizers
+	dst.Spec.ValueEncoding = src.Spec.ValueEncoding
+	dst.Spec.Format = src.Spec.Format
+	dst.Spec.BinaryKey = src.Spec.BinaryKey
+	dst.Spec.DecryptionKeyRef = (*v1.SopsSecretKeyReference)(src.Spec.DecryptionKeyRef)
+	dst.Spec.AllowUnencrypted = src.Spec.AllowUnencrypted
+	dst.Spec.Template.SopsSecretTemplateMetadata = v1.SopsSecretTemplateMetadata(src.Spec.Template.SopsSecretTemplateMetadata)
+	dst.Spec.Template.Data = src.Spec.Template.Data
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.LastSyncTime = src.Status.LastSyncTime
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.Targets = nil
+	for _, target := range src.Status.Targets {
+		dst.Status.Targets = append(dst.Status.Targets, v1.SopsSecretTargetStatus(target))
+	}
+	dst.Status.PrunedTargets = nil
+	for _, target := range src.Status.PrunedTargets {
+		dst.Status.PrunedTargets = append(dst.Status.PrunedTargets, v1.SopsSecretTargetReference(target))
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1) to this version.
+func (dst *SopsSecret) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.SopsSecret)
+	dst.ObjectMeta = src.ObjectMeta
+
+	dst.Type = src.Spec.Type
+	dst.Data = src.Spec.EncryptedData
+	dst.Spec.IgnoredKeys = src.Spec.IgnoredKeys
+	dst.Spec.DeletionPolicy = src.Spec.DeletionPolicy
+	dst.Spec.SkipFinalizers = src.Spec.SkipFinalizers
+	dst.Spec.ValueEncoding = src.Spec.ValueEncoding
+	dst.Spec.Format = src.Spec.Format
+	dst.Spec.BinaryKey = src.Spec.BinaryKey
+	dst.Spec.DecryptionKeyRef = (*SopsSecretKeyReference)(src.Spec.DecryptionKeyRef)
+	dst.Spec.AllowUnencrypted = src.Spec.AllowUnencrypted
+	dst.Spec.Template.SopsSecretTemplateMetadata = SopsSecretTemplateMetadata(src.Spec.Template.SopsSecretTemplateMetadata)
+	dst.Spec.Template.Data = src.Spec.Template.Data
+
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.LastSyncTime = src.Status.LastSyncTime
+	dst.Status.Conditions = src.Status.Conditions
+	dst.Status.Targets = nil
+	for _, target := range src.Status.Targets {
+		dst.Status.Targets = append(dst.Status.Targets, SopsSecretTargetStatus(target))
+	}
+	dst.Status.PrunedTargets = nil
+	for _, target := range src.Status.PrunedTargets {
+		dst.Status.PrunedTargets = append(dst.Status.PrunedTargets, SopsSecretTargetReference(target))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/dhouti/sops-converter/api/v1"
+)
+
+func TestSopsSecretRoundTrip(t *testing.T) {
+	now := metav1.Now()
+	original := &SopsSecret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "default", Generation: 2},
+		Type:       corev1.SecretTypeTLS,
+		Data:       "tls.crt: ENC[...]\n",
+		Spec: SopsSecretSpec{
+			IgnoredKeys:      []string{"tls.key"},
+			DeletionPolicy:   DeletionPolicyRetain,
+			SkipFinalizers:   true,
+			ValueEncoding:    "flatten",
+			Format:           "dotenv",
+			DecryptionKeyRef: &SopsSecretKeyReference{Name: "team-keys", Key: "age.txt"},
+			AllowUnencrypted: true,
+			Template: SopsSecretTemplate{
+				SopsSecretTemplateMetadata: SopsSecretTemplateMetadata{
+					Name:              "other-name",
+					Namespaces:        []string{"default", "other"},
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+					Annotations:       map[string]string{"a": "b"},
+					Labels:            map[string]string{"c": "d"},
+				},
+				Data: map[string]string{"url": "postgres://{{ .user }}@db"},
+			},
+		},
+		Status: SopsSecretStatus{
+			ObservedGeneration: 2,
+			LastSyncTime:       &now,
+			Conditions:         []metav1.Condition{{Type: ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonReconciled}},
+			Targets:            []SopsSecretTargetStatus{{Namespace: "default", Name: "other-name", Synced: true}, {Namespace: "kube-system", Name: "other-name", Denied: true}},
+			PrunedTargets:      []SopsSecretTargetReference{{Namespace: "default", Name: "my-secret"}},
+		},
+	}
+
+	hub := &v1.SopsSecret{}
+	if err := original.ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo failed: %v", err)
+	}
+	if hub.Spec.Type != original.Type || hub.Spec.EncryptedData != original.Data {
+		t.Errorf("type and data were not moved to the spec: %+v", hub.Spec)
+	}
+
+	converted := &SopsSecret{}
+	if err := converted.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom failed: %v", err)
+	}
+	if !reflect.DeepEqual(original, converted) {
+		t.Errorf("round trip changed the object:\nexpected %+v\ngot      %+v", original, converted)
+	}
+}
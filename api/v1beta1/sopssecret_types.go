@@ -21,17 +21,80 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+// Condition types reported in SopsSecretStatus.Conditions.
+const (
+	// ConditionReady is True when the payload was decrypted and every target Secret is in sync.
+	ConditionReady = "Ready"
+	// ConditionDecrypted is True when the encrypted payload could be decrypted, parsed and rendered.
+	ConditionDecrypted = "Decrypted"
+	// ConditionSynced is True when every target Secret matches the decrypted payload.
+	ConditionSynced = "Synced"
+)
+
+// Condition reasons reported in SopsSecretStatus.Conditions.
+const (
+	ReasonReconciled      = "Reconciled"
+	ReasonDecryptFailed   = "DecryptFailed"
+	ReasonInvalidPayload  = "InvalidPayload"
+	ReasonTemplateFailed  = "TemplateFailed"
+	ReasonSyncFailed      = "SyncFailed"
+	ReasonDeleteFailed    = "DeleteFailed"
+	ReasonKeyUnavailable  = "KeyUnavailable"
+	ReasonTargetDenied    = "TargetDenied"
+	ReasonRecipientDenied = "RecipientDenied"
+	ReasonUnencrypted     = "Unencrypted"
+)
+
+// Deletion policies of SopsSecretSpec.DeletionPolicy.
+const (
+	// DeletionPolicyDelete deletes the generated Secrets along with the SopsSecret.
+	DeletionPolicyDelete = "Delete"
+	// DeletionPolicyRetain keeps the generated Secrets when the SopsSecret is deleted.
+	DeletionPolicyRetain = "Retain"
+)
+
+// SopsSecretTargetStatus is the observed state of a single generated Secret
+type SopsSecretTargetStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Synced    bool   `json:"synced"`
+	// Message explains why the target is not synced, or not deleted while the SopsSecret is being deleted.
+	Message string `json:"message,omitempty"`
+	// Deleted is true once the target was deleted while the SopsSecret is being deleted.
+	// +optional
+	Deleted bool `json:"deleted,omitempty"`
+	// Denied is true when the target policy doesn't allow the SopsSecret to write the target.
+	// +optional
+	Denied bool `json:"denied,omitempty"`
+}
+
+// SopsSecretTargetReference identifies a generated Secret
+type SopsSecretTargetReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
 
 // SopsSecretStatus defines the observed state of SopsSecret
 type SopsSecretStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the generation last processed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncTime is the last time every target Secret was successfully synced.
+	LastSyncTime *metav1.Time             `json:"lastSyncTime,omitempty"`
+	Conditions   []metav1.Condition       `json:"conditions,omitempty"`
+	Targets      []SopsSecretTargetStatus `json:"targets,omitempty"`
+	// PrunedTargets lists the Secrets deleted since the last change of the spec
+	// because they were no longer a target, e.g. after the template name changed.
+	// +optional
+	PrunedTargets []SopsSecretTargetReference `json:"prunedTargets,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Last Sync",type="date",JSONPath=".status.lastSyncTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // SopsSecret is the Schema for the sopssecrets API
 type SopsSecret struct {
@@ -54,18 +117,67 @@ type SopsSecretList struct {
 }
 
 type SopsSecretSpec struct {
-	Template       SopsSecretTemplate `json:"template,omitempty"`
-	IgnoredKeys    []string           `json:"ignoredKeys,omitempty"`
-	SkipFinalizers bool               `json:"skipFinalizers,omitempty"`
+	Template    SopsSecretTemplate `json:"template,omitempty"`
+	IgnoredKeys []string           `json:"ignoredKeys,omitempty"`
+
+	// DeletionPolicy controls whether the generated Secrets are deleted with the SopsSecret, Delete when unset.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// SkipFinalizers retains the generated Secrets when DeletionPolicy is unset.
+	// Deprecated: set DeletionPolicy to Retain instead.
+	// +optional
+	SkipFinalizers bool `json:"skipFinalizers,omitempty"`
+
+	// ValueEncoding controls how nested values of the decrypted data are stored.
+	// "json" and "yaml" serialize them, "flatten" stores one key per leaf with the keys joined by dots.
+	// Nested values are rejected when unset.
+	// +kubebuilder:validation:Enum=json;yaml;flatten
+	// +optional
+	ValueEncoding string `json:"valueEncoding,omitempty"`
+
+	// Format is the sops format of the encrypted data, yaml when unset.
+	// +kubebuilder:validation:Enum=yaml;json;dotenv;ini;binary
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// BinaryKey is the Secret key holding the whole plaintext in the binary format.
+	// +optional
+	BinaryKey string `json:"binaryKey,omitempty"`
+
+	// DecryptionKeyRef points to a Secret in the namespace of the SopsSecret holding the age or PGP private keys
+	// the encrypted data is decrypted with, instead of the keys of the controller.
+	// +optional
+	DecryptionKeyRef *SopsSecretKeyReference `json:"decryptionKeyRef,omitempty"`
+
+	// AllowUnencrypted accepts encrypted data without sops metadata or with plaintext values, only meant for tests.
+	// +optional
+	AllowUnencrypted bool `json:"allowUnencrypted,omitempty"`
+}
+
+// SopsSecretKeyReference selects the private keys of a Secret
+type SopsSecretKeyReference struct {
+	// Name of the Secret, in the namespace of the SopsSecret.
+	Name string `json:"name"`
+	// Key of the Secret holding the private keys, every key of the Secret is used when unset.
+	// +optional
+	Key string `json:"key,omitempty"`
 }
 
 type SopsSecretTemplate struct {
 	SopsSecretTemplateMetadata `json:"metadata,omitempty"`
+
+	// Data maps Secret keys to Go text/template strings rendered against the decrypted values.
+	// Rendered keys are added to the decrypted keys, replacing the ones with the same name.
+	// +optional
+	Data map[string]string `json:"data,omitempty"`
 }
 
 type SopsSecretTemplateMetadata struct {
 	Name       string   `json:"name,omitempty"`
 	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects additional target namespaces by label.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
 
 	Annotations map[string]string `json:"annotations,omitempty"`
 	Labels      map[string]string `json:"labels,omitempty"`
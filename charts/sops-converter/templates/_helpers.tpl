@@ -66,4 +66,10 @@ Create the kind of the RAC role
 */}}
 {{- define "sops-converter.roleKind" -}}
 {{- if .Values.rbac.clusterScoped -}}Cluster{{- end -}}Role
-{{- end }}
\ No newline at end of file
+{{- end }}
+{{/*
+The Secret holding the serving certificate of the webhooks
+*/}}
+{{- define "sops-converter.webhookTLSSecret" -}}
+{{- default (printf "%s-webhook-tls" (include "sops-converter.fullname" .)) .Values.webhook.tlsSecret }}
+{{- end }}
@@ -19,24 +19,29 @@ package cmd
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/client-go/kubernetes/scheme"
 
-	secretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+	"github.com/dhouti/sops-converter/pkg/secretdata"
 )
 
 type convertOptions struct {
 	args       []string
 	TargetFile []byte
+	// Format is the sops format of the encrypted data, taken out of the args passed to sops.
+	Format string
 }
 
 // convertCmd represents the convert command
@@ -67,6 +72,29 @@ func (o *convertOptions) validate(args []string) error {
 }
 
 func (o *convertOptions) complete(args []string) error {
+	// Flag parsing is disabled so every other arg reaches sops, pull --format out by hand
+	o.Format = decrypt.FormatYAML
+	var sopsArgs []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--format" && i+1 < len(args):
+			o.Format = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--format="):
+			o.Format = strings.TrimPrefix(args[i], "--format=")
+		default:
+			sopsArgs = append(sopsArgs, args[i])
+		}
+	}
+	switch o.Format {
+	case decrypt.FormatYAML, decrypt.FormatJSON, decrypt.FormatDotenv, decrypt.FormatINI, decrypt.FormatBinary:
+	default:
+		return fmt.Errorf("unknown format %q, must be one of yaml, json, dotenv, ini, binary", o.Format)
+	}
+	if len(sopsArgs) == 0 {
+		return errors.New("first arg must be a target filename")
+	}
+	args = sopsArgs
 	o.args = args
 
 	targetFile, err := ioutil.ReadFile(args[0])
@@ -95,20 +123,37 @@ func (o *convertOptions) process(args []string) error {
 		return errors.New("file is not a Secret")
 	}
 
-	tmpSecretData := make(map[string]string)
-	for k, v := range secret.Data {
-		tmpSecretData[k] = string(v)
-	}
+	var secretData []byte
+	var binaryKey string
+	if o.Format == decrypt.FormatBinary {
+		// The whole plaintext is the single value of the secret
+		rawData := make(map[string][]byte)
+		for k, v := range secret.Data {
+			rawData[k] = v
+		}
+		for k, v := range secret.StringData {
+			rawData[k] = []byte(v)
+		}
+		if len(rawData) != 1 {
+			return fmt.Errorf("the binary format stores a single key, the secret has %d", len(rawData))
+		}
+		for k, v := range rawData {
+			binaryKey, secretData = k, v
+		}
+	} else {
+		// Binary values are base64 encoded with a marker the controller decodes
+		tmpSecretData := secretdata.Encode(secret.Data)
 
-	// Merge stringData into Data
-	for k, v := range secret.StringData {
-		tmpSecretData[k] = v
-	}
+		// Merge stringData into Data
+		for k, v := range secret.StringData {
+			tmpSecretData[k] = v
+		}
 
-	secretData, err := yaml.Marshal(tmpSecretData)
-	if err != nil {
-		log.Fatalf("[FATAL] yaml.Marshal error: %v", err)
-		return err
+		secretData, err = secretdata.Marshal(tmpSecretData, o.Format)
+		if err != nil {
+			log.Errorf("failed to write the %s document: %v", o.Format, err)
+			return err
+		}
 	}
 
 	tmpfile, err := ioutil.TempFile("", ".*.yml")
@@ -122,7 +167,7 @@ func (o *convertOptions) process(args []string) error {
 	tmpfile.Sync()
 
 	// run sops encrypt directly
-	sopsCommandArgs := append([]string{"--encrypt", "--output-type", "yaml"}, args[1:]...)
+	sopsCommandArgs := append([]string{"--encrypt", "--input-type", o.Format, "--output-type", o.Format}, o.args[1:]...)
 	sopsCommandArgs = append(sopsCommandArgs, tmpfile.Name())
 
 	var sopsStdout bytes.Buffer
@@ -136,17 +181,21 @@ func (o *convertOptions) process(args []string) error {
 		return err
 	}
 
-	generatedSopsSecret := &secretsv1beta1.SopsSecret{}
-	generatedSopsSecret.Type = secret.Type
+	generatedSopsSecret := &secretsv1.SopsSecret{}
+	generatedSopsSecret.Spec.Type = secret.Type
 	generatedSopsSecret.ObjectMeta = secret.ObjectMeta
 	generatedSopsSecret.Spec.Template.Annotations = secret.ObjectMeta.Annotations
 	generatedSopsSecret.Spec.Template.Labels = secret.ObjectMeta.Labels
-	generatedSopsSecret.Data = sopsStdout.String()
+	generatedSopsSecret.Spec.EncryptedData = sopsStdout.String()
+	if o.Format != decrypt.FormatYAML {
+		generatedSopsSecret.Spec.Format = o.Format
+	}
+	generatedSopsSecret.Spec.BinaryKey = binaryKey
 
 	// Set the GVK or YAMLPrinter doesn't work
 	gvk := schema.GroupVersionKind{
 		Group:   "secrets.dhouti.dev",
-		Version: "v1beta1",
+		Version: "v1",
 		Kind:    "SopsSecret",
 	}
 	generatedSopsSecret.GetObjectKind().SetGroupVersionKind(gvk)
@@ -30,7 +30,9 @@ import (
 	"gopkg.in/yaml.v3"
 	"k8s.io/client-go/kubernetes/scheme"
 
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
 	secretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
+	"github.com/dhouti/sops-converter/pkg/decrypt"
 )
 
 type editOptions struct {
@@ -95,7 +97,7 @@ func (o *editOptions) process(args []string) error {
 		allDocuments = append(allDocuments, originalYaml)
 	}
 
-	allObjects := map[int]*secretsv1beta1.SopsSecret{}
+	allObjects := map[int]*secretsv1.SopsSecret{}
 	for index, document := range allDocuments {
 		// Convert back to yaml to parse again.
 		documentBytes, err := yaml.Marshal(&document)
@@ -112,12 +114,19 @@ func (o *editOptions) process(args []string) error {
 		}
 
 		// Assert that object is SopsSecret, if not exit
-		sopsSecret, ok := m.(*secretsv1beta1.SopsSecret)
-		if !ok {
+		switch sopsSecret := m.(type) {
+		case *secretsv1.SopsSecret:
+			allObjects[index] = sopsSecret
+		case *secretsv1beta1.SopsSecret:
+			converted := &secretsv1.SopsSecret{}
+			if err = sopsSecret.ConvertTo(converted); err != nil {
+				return err
+			}
+			allObjects[index] = converted
+		default:
 			// Not a SopsSecret, skip
 			continue
 		}
-		allObjects[index] = sopsSecret
 	}
 
 	if len(allObjects) == 0 {
@@ -145,11 +154,16 @@ func (o *editOptions) process(args []string) error {
 
 	defer tmpfile.Close()
 	defer os.Remove(tmpfile.Name())
-	bytes.NewReader([]byte(sopsSecret.Data)).WriteTo(tmpfile)
+	bytes.NewReader([]byte(sopsSecret.Spec.EncryptedData)).WriteTo(tmpfile)
 	tmpfile.Sync()
 
+	format := sopsSecret.Spec.Format
+	if format == "" {
+		format = decrypt.FormatYAML
+	}
+
 	// Open sops editor directly
-	sopsCommand := exec.Command("sops", tmpfile.Name())
+	sopsCommand := exec.Command("sops", "--input-type", format, "--output-type", format, tmpfile.Name())
 	sopsCommand.Stdin = os.Stdin
 	sopsCommand.Stdout = os.Stdout
 	sopsCommand.Stderr = os.Stderr
@@ -185,15 +199,15 @@ func (o *editOptions) process(args []string) error {
 		return err
 	}
 
-	// update data
-	appIdx := -1
-	for i, k := range targetYamlMap.Content[0].Content {
-		if k.Value == "data" {
-			appIdx = i + 1
-			break
-		}
+	// update data, v1beta1 keeps it at the top level
+	dataNode := mappingValue(mappingValue(targetYamlMap.Content[0], "spec"), "encryptedData")
+	if dataNode == nil {
+		dataNode = mappingValue(targetYamlMap.Content[0], "data")
+	}
+	if dataNode == nil {
+		return errors.New("encrypted data not found")
 	}
-	targetYamlMap.Content[0].Content[appIdx].Value = string(tmpfileContents)
+	dataNode.Value = string(tmpfileContents)
 
 	allDocuments[targetIndex] = targetYamlMap
 	var outBuffer bytes.Buffer
@@ -218,3 +232,16 @@ func (o *editOptions) process(args []string) error {
 	}
 	return nil
 }
+
+// mappingValue returns the value of key in a yaml mapping node, or nil when it's not set.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/spf13/cobra"
 	"k8s.io/client-go/kubernetes/scheme"
 
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
 	secretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
 )
 
@@ -46,6 +47,7 @@ func Execute() {
 
 func init() {
 	secretsv1beta1.AddToScheme(scheme.Scheme)
+	secretsv1.AddToScheme(scheme.Scheme)
 }
 
 func HandleError(err error) (b bool) {
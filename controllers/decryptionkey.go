@@ -0,0 +1,90 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+)
+
+// decryptionKeys returns the private keys spec.decryptionKeyRef points to, and a checksum of them.
+// The Secret is always read from the namespace of obj, so a SopsSecret can't use the keys of another tenant.
+func (r *SopsSecretReconciler) decryptionKeys(ctx context.Context, obj *secretsv1.SopsSecret) (*decrypt.Keys, string, error) {
+	ref := obj.Spec.DecryptionKeyRef
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: ref.Name}, secret); err != nil {
+		return nil, "", fmt.Errorf("unable to get decryption key secret %s: %v", ref.Name, err)
+	}
+
+	files := secret.Data
+	if ref.Key != "" {
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, "", fmt.Errorf("decryption key secret %s has no key %s", ref.Name, ref.Key)
+		}
+		files = map[string][]byte{ref.Key: value}
+	}
+
+	keys, err := decrypt.ParseKeys(files)
+	if err != nil {
+		return nil, "", fmt.Errorf("decryption key secret %s: %v", ref.Name, err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var material []byte
+	for _, name := range names {
+		material = append(material, name...)
+		material = append(material, 0)
+		material = append(material, files[name]...)
+		material = append(material, 0)
+	}
+	return keys, hashItem(material), nil
+}
+
+// mapKeySecretToSopsSecrets reconciles the SopsSecrets decrypted with the keys of a Secret when it changes.
+func (r *SopsSecretReconciler) mapKeySecretToSopsSecrets(o client.Object) []reconcile.Request {
+	sopsSecretList := &secretsv1.SopsSecretList{}
+	if err := r.List(context.Background(), sopsSecretList, client.InNamespace(o.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list sopssecrets", "namespace", o.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, sopsSecret := range sopsSecretList.Items {
+		ref := sopsSecret.Spec.DecryptionKeyRef
+		if ref == nil || ref.Name != o.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&sopsSecret),
+		})
+	}
+	return requests
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+)
+
+// finalize deletes the target secrets of obj, which is being deleted, but the ones the target policy denies.
+// DeletionFinalizer is only removed once every target is gone, otherwise the state of
+// each target is recorded in the status and the deletion is retried.
+func (r *SopsSecretReconciler) finalize(ctx context.Context, log logr.Logger, obj *secretsv1.SopsSecret, desired []types.NamespacedName, denied map[types.NamespacedName]bool) error {
+	if !controllerutil.ContainsFinalizer(obj, DeletionFinalizer) {
+		return nil
+	}
+
+	var errs []error
+	targets := make([]secretsv1.SopsSecretTargetStatus, 0, len(desired))
+	for _, secretDestination := range desired {
+		target := secretsv1.SopsSecretTargetStatus{
+			Name:      secretDestination.Name,
+			Namespace: secretDestination.Namespace,
+		}
+		if denied[secretDestination] {
+			// Never written, a Secret there was written by someone else or before the policy was enforced
+			target.Denied = true
+			targets = append(targets, target)
+			continue
+		}
+
+		// Keep going so every target is attempted, the errors are returned below
+		if err := r.deleteTarget(ctx, obj, secretDestination); err != nil {
+			target.Message = err.Error()
+			errs = append(errs, err)
+		} else {
+			target.Deleted = true
+		}
+		targets = append(targets, target)
+	}
+
+	if len(errs) > 0 {
+		meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+			Type:               secretsv1.ConditionReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             secretsv1.ReasonDeleteFailed,
+			Message:            fmt.Sprintf("%d of %d target secrets could not be deleted", len(errs), len(targets)),
+			ObservedGeneration: obj.GetGeneration(),
+		})
+		obj.Status.Targets = targets
+		if err := r.Status().Update(ctx, obj); err != nil {
+			errs = append(errs, fmt.Errorf("unable to update status: %v", err))
+		}
+		return utilerrors.NewAggregate(errs)
+	}
+
+	// Every target is gone, let the object go
+	controllerutil.RemoveFinalizer(obj, DeletionFinalizer)
+	if err := r.Update(ctx, obj); err != nil {
+		return fmt.Errorf("unable to remove finalizer %v", err)
+	}
+	log.Info("finalizer was removed...")
+	return nil
+}
+
+// deleteTarget deletes the secret at secretDestination.
+// Missing secrets and secrets obj doesn't own, including the ones of other SopsSecrets, count as deleted.
+func (r *SopsSecretReconciler) deleteTarget(ctx context.Context, obj *secretsv1.SopsSecret, secretDestination types.NamespacedName) error {
+	fetchSecret := &corev1.Secret{}
+	err := r.Get(ctx, secretDestination, fetchSecret)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !ownedBy(fetchSecret, obj) {
+		return nil
+	}
+
+	// The UID precondition makes sure a secret recreated by someone else in the meantime is left alone
+	err = r.Delete(ctx, fetchSecret, client.Preconditions{UID: &fetchSecret.UID})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonDeleted, "Deleted secret %s", secretDestination)
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+)
+
+// DecryptorCheck reports whether the decryptor is usable.
+// Decryptors implementing decrypt.Checker are checked first, e.g. for missing age identities,
+// then with a canary the decryptor must also decrypt it.
+// The result is kept for interval, so frequent probes don't each run sops and a KMS round trip.
+func (r *SopsSecretReconciler) DecryptorCheck(canary []byte, format string, interval time.Duration) healthz.Checker {
+	var mu sync.Mutex
+	var checked time.Time
+	var lastErr error
+
+	return func(_ *http.Request) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !checked.IsZero() && time.Since(checked) < interval {
+			return lastErr
+		}
+		lastErr = r.checkDecryptor(canary, format)
+		checked = time.Now()
+		return lastErr
+	}
+}
+
+func (r *SopsSecretReconciler) checkDecryptor(canary []byte, format string) error {
+	decryptor, _ := r.decryptState()
+	if checker, ok := decryptor.(decrypt.Checker); ok {
+		if err := checker.Check(); err != nil {
+			return err
+		}
+	}
+	if len(canary) > 0 {
+		// Only the error matters, the plaintext is dropped right away
+		if _, err := decryptor.Decrypt(canary, format); err != nil {
+			return fmt.Errorf("unable to decrypt the canary: %v", err)
+		}
+	}
+	return nil
+}
+
+// LivezCheck fails when a reconcile has been running for longer than WedgedTimeout,
+// e.g. because sops hangs waiting on a KMS or a GPG agent.
+func (r *SopsSecretReconciler) LivezCheck(_ *http.Request) error {
+	if r.WedgedTimeout <= 0 {
+		return nil
+	}
+	key, started, ok := r.inFlight.oldest()
+	if ok && time.Since(started) > r.WedgedTimeout {
+		return fmt.Errorf("reconcile of %s has been running for %s", key, time.Since(started).Round(time.Second))
+	}
+	return nil
+}
+
+// inFlightTracker keeps the start time of the reconciles in progress.
+type inFlightTracker struct {
+	mu      sync.Mutex
+	started map[types.NamespacedName]time.Time
+}
+
+// track records key as in progress until the returned function is called.
+func (t *inFlightTracker) track(key types.NamespacedName) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.started == nil {
+		t.started = make(map[types.NamespacedName]time.Time)
+	}
+	t.started[key] = time.Now()
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.started, key)
+	}
+}
+
+// oldest returns the reconcile in progress for the longest time.
+func (t *inFlightTracker) oldest() (types.NamespacedName, time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var oldestKey types.NamespacedName
+	var oldestStart time.Time
+	for key, started := range t.started {
+		if oldestStart.IsZero() || started.Before(oldestStart) {
+			oldestKey, oldestStart = key, started
+		}
+	}
+	return oldestKey, oldestStart, !oldestStart.IsZero()
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	decryptmocks "github.com/dhouti/sops-converter/pkg/decrypt/mocks"
+)
+
+type fakeChecker struct {
+	decryptmocks.DecryptorMock
+	err   error
+	calls int
+}
+
+func (c *fakeChecker) Check() error {
+	c.calls++
+	return c.err
+}
+
+func TestDecryptorCheckCanary(t *testing.T) {
+	decryptErr := errors.New("no key could decrypt the data key")
+	decryptor := &decryptmocks.DecryptorMock{
+		DecryptFunc: func(data []byte, format string) ([]byte, error) {
+			return nil, decryptErr
+		},
+	}
+	r := &SopsSecretReconciler{Decryptor: decryptor}
+
+	check := r.DecryptorCheck([]byte("canary"), "yaml", time.Hour)
+	for i := 0; i < 3; i++ {
+		if err := check(nil); err == nil || !strings.Contains(err.Error(), decryptErr.Error()) {
+			t.Fatalf("expected the canary error, got %v", err)
+		}
+	}
+	if calls := decryptor.DecryptCalls(); len(calls) != 1 {
+		t.Fatalf("expected the canary to be decrypted once within the interval, got %d", len(calls))
+	} else if string(calls[0].Bytes) != "canary" || calls[0].S != "yaml" {
+		t.Errorf("expected the canary to be decrypted as yaml, got %q as %q", calls[0].Bytes, calls[0].S)
+	}
+
+	decryptor.DecryptFunc = func(data []byte, format string) ([]byte, error) {
+		return []byte("plaintext"), nil
+	}
+	check = r.DecryptorCheck([]byte("canary"), "yaml", 0)
+	for i := 0; i < 2; i++ {
+		if err := check(nil); err != nil {
+			t.Fatalf("expected the canary to decrypt, got %v", err)
+		}
+	}
+	if calls := decryptor.DecryptCalls(); len(calls) != 3 {
+		t.Errorf("expected the canary to be decrypted on every check without an interval, got %d calls", len(calls))
+	}
+}
+
+func TestDecryptorCheckChecker(t *testing.T) {
+	checker := &fakeChecker{err: errors.New("sops not found")}
+	r := &SopsSecretReconciler{Decryptor: checker}
+
+	check := r.DecryptorCheck(nil, "yaml", time.Hour)
+	if err := check(nil); err != checker.err {
+		t.Fatalf("expected the checker error, got %v", err)
+	}
+	checker.err = nil
+	if err := check(nil); err == nil {
+		t.Error("expected the failed check to be reused within the interval")
+	}
+	if checker.calls != 1 {
+		t.Errorf("expected a single check within the interval, got %d", checker.calls)
+	}
+	if calls := checker.DecryptCalls(); len(calls) != 0 {
+		t.Errorf("expected nothing to be decrypted without a canary, got %d calls", len(calls))
+	}
+
+	// A canary encrypted to other keys must not hide that the age identities are gone
+	checker = &fakeChecker{err: errors.New("no age identity found")}
+	r = &SopsSecretReconciler{Decryptor: checker}
+	if err := r.DecryptorCheck([]byte("canary"), "yaml", 0)(nil); err != checker.err {
+		t.Fatalf("expected the checker error with a canary, got %v", err)
+	}
+	if calls := checker.DecryptCalls(); len(calls) != 0 {
+		t.Errorf("expected the canary not to be decrypted after a failed check, got %d calls", len(calls))
+	}
+
+	r = &SopsSecretReconciler{Decryptor: &decryptmocks.DecryptorMock{}}
+	if err := r.DecryptorCheck(nil, "yaml", 0)(nil); err != nil {
+		t.Errorf("expected decryptors without a check to pass, got %v", err)
+	}
+}
+
+func TestLivezCheck(t *testing.T) {
+	r := &SopsSecretReconciler{WedgedTimeout: time.Minute}
+	key := types.NamespacedName{Namespace: "default", Name: "wedged"}
+
+	done := r.inFlight.track(key)
+	if err := r.LivezCheck(nil); err != nil {
+		t.Fatalf("expected a recent reconcile to be alive, got %v", err)
+	}
+
+	r.inFlight.started[key] = time.Now().Add(-2 * time.Minute)
+	if err := r.LivezCheck(nil); err == nil || !strings.Contains(err.Error(), key.String()) {
+		t.Fatalf("expected the wedged reconcile of %s to be reported, got %v", key, err)
+	}
+
+	r.WedgedTimeout = 0
+	if err := r.LivezCheck(nil); err != nil {
+		t.Errorf("expected no check without a timeout, got %v", err)
+	}
+
+	r.WedgedTimeout = time.Minute
+	done()
+	if err := r.LivezCheck(nil); err != nil {
+		t.Errorf("expected the finished reconcile to be forgotten, got %v", err)
+	}
+}
+
+func TestInFlightTracker(t *testing.T) {
+	var tracker inFlightTracker
+	if _, _, ok := tracker.oldest(); ok {
+		t.Fatal("expected no reconcile in progress")
+	}
+
+	first := types.NamespacedName{Namespace: "default", Name: "first"}
+	second := types.NamespacedName{Namespace: "default", Name: "second"}
+	doneFirst := tracker.track(first)
+	doneSecond := tracker.track(second)
+	tracker.started[first] = time.Now().Add(-time.Minute)
+
+	if key, _, ok := tracker.oldest(); !ok || key != first {
+		t.Fatalf("expected %s to be the oldest, got %s", first, key)
+	}
+	doneFirst()
+	if key, _, ok := tracker.oldest(); !ok || key != second {
+		t.Fatalf("expected %s to be the oldest, got %s", second, key)
+	}
+	doneSecond()
+	if _, _, ok := tracker.oldest(); ok {
+		t.Error("expected no reconcile in progress once both are done")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "sops_converter"
+
+// Values of the operation label of secretOperationsTotal.
+const (
+	secretOperationCreated = "created"
+	secretOperationUpdated = "updated"
+	secretOperationSkipped = "skipped"
+)
+
+// Values of the class label of decryptFailuresTotal.
+const (
+	decryptErrorBinaryMissing = "binary_missing"
+	decryptErrorNoKey         = "no_key"
+	decryptErrorMacMismatch   = "mac_mismatch"
+	decryptErrorInvalidInput  = "invalid_input"
+	decryptErrorUnknown       = "unknown"
+)
+
+var (
+	decryptDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "decrypt_duration_seconds",
+		Help:      "Time spent decrypting SopsSecret payloads.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	})
+	decryptFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "decrypt_failures_total",
+		Help:      "Number of failed SopsSecret decryptions by error class.",
+	}, []string{"class"})
+	secretOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "secret_operations_total",
+		Help:      "Number of target Secrets created, updated or skipped because they already matched.",
+	}, []string{"operation"})
+	secretDriftTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "secret_drift_total",
+		Help:      "Number of target Secrets overwritten after being modified outside of the controller.",
+	})
+	sopsSecretsNotInSync = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sopssecrets_not_in_sync",
+		Help:      "Number of SopsSecrets whose target Secrets are not all in sync.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		decryptDuration,
+		decryptFailuresTotal,
+		secretOperationsTotal,
+		secretDriftTotal,
+		sopsSecretsNotInSync,
+	)
+}
+
+// classifyDecryptError maps a Decryptor error to a low cardinality class.
+func classifyDecryptError(err error) string {
+	if errors.Is(err, exec.ErrNotFound) {
+		return decryptErrorBinaryMissing
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Failed to get the data key"), strings.Contains(msg, "no key could"):
+		return decryptErrorNoKey
+	case strings.Contains(msg, "MAC mismatch"):
+		return decryptErrorMacMismatch
+	case strings.Contains(msg, "Error unmarshalling input"), strings.Contains(msg, "Could not unmarshal input"),
+		strings.Contains(msg, "sops metadata not found"):
+		return decryptErrorInvalidInput
+	}
+	return decryptErrorUnknown
+}
+
+// syncTracker keeps the set of SopsSecrets that are not in sync behind sopsSecretsNotInSync.
+type syncTracker struct {
+	mu        sync.Mutex
+	notInSync map[types.NamespacedName]struct{}
+}
+
+var notInSync = &syncTracker{notInSync: map[types.NamespacedName]struct{}{}}
+
+func (t *syncTracker) set(key types.NamespacedName, inSync bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if inSync {
+		delete(t.notInSync, key)
+	} else {
+		t.notInSync[key] = struct{}{}
+	}
+	sopsSecretsNotInSync.Set(float64(len(t.notInSync)))
+}
+
+func (t *syncTracker) forget(key types.NamespacedName) {
+	t.set(key, true)
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+	decryptmocks "github.com/dhouti/sops-converter/pkg/decrypt/mocks"
+)
+
+func TestDecryptFailuresTotal(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{&exec.Error{Name: "sops", Err: exec.ErrNotFound}, decryptErrorBinaryMissing},
+		{errors.New("failed to decrypt file: Failed to get the data key required to decrypt the SOPS file."), decryptErrorNoKey},
+		{errors.New("failed to decrypt file: no key could decrypt the data key"), decryptErrorNoKey},
+		{errors.New("failed to decrypt file: MAC mismatch. File has 1234, computed 5678"), decryptErrorMacMismatch},
+		{errors.New("failed to decrypt file: Error unmarshalling input yaml: did not find expected key"), decryptErrorInvalidInput},
+		{errors.New("failed to decrypt file: sops metadata not found"), decryptErrorInvalidInput},
+		{errors.New("Could not unmarshal input data: key-value delimiter not found"), decryptErrorInvalidInput},
+		{errors.New("context deadline exceeded"), decryptErrorUnknown},
+	}
+	for _, test := range tests {
+		err := test.err
+		if class := classifyDecryptError(err); class != test.class {
+			t.Errorf("classifyDecryptError(%q) = %s, want %s", err, class, test.class)
+			continue
+		}
+
+		r := &SopsSecretReconciler{
+			Decryptor: &decryptmocks.DecryptorMock{
+				DecryptFunc: func(data []byte, format string) ([]byte, error) {
+					return nil, err
+				},
+			},
+			Client:   fake.NewClientBuilder().Build(),
+			Recorder: record.NewFakeRecorder(1),
+		}
+		obj := &secretsv1.SopsSecret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "metrics"},
+			Spec:       secretsv1.SopsSecretSpec{AllowUnencrypted: true},
+		}
+
+		counter := decryptFailuresTotal.WithLabelValues(test.class)
+		before := testutil.ToFloat64(counter)
+		if _, loadErr := r.loadPayload(context.Background(), logr.Discard(), obj); loadErr == nil {
+			t.Fatalf("expected loading the payload to fail with %v", err)
+		}
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("expected %s to be counted once, got %v", test.class, got)
+		}
+	}
+}
+
+func TestNotInSyncGauge(t *testing.T) {
+	tracker := &syncTracker{notInSync: map[types.NamespacedName]struct{}{}}
+	first := types.NamespacedName{Namespace: "default", Name: "first"}
+	second := types.NamespacedName{Namespace: "default", Name: "second"}
+
+	steps := []struct {
+		name  string
+		apply func()
+		want  float64
+	}{
+		{"first out of sync", func() { tracker.set(first, false) }, 1},
+		{"first out of sync again", func() { tracker.set(first, false) }, 1},
+		{"second out of sync", func() { tracker.set(second, false) }, 2},
+		{"first back in sync", func() { tracker.set(first, true) }, 1},
+		{"first in sync again", func() { tracker.set(first, true) }, 1},
+		{"second deleted", func() { tracker.forget(second) }, 0},
+		{"unknown deleted", func() { tracker.forget(first) }, 0},
+	}
+	for _, step := range steps {
+		step.apply()
+		if got := testutil.ToFloat64(sopsSecretsNotInSync); got != step.want {
+			t.Errorf("%s: expected %v SopsSecrets not in sync, got %v", step.name, step.want, got)
+		}
+	}
+}
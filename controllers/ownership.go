@@ -0,0 +1,126 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+)
+
+// ownershipLabelValue is the value of OwnershipLabel on secrets owned by obj.
+// Names may contain dots and be longer than a label value, so the owner is hashed
+// and spelled out in the OwnerNameAnnotation and OwnerNamespaceAnnotation annotations.
+func ownershipLabelValue(obj client.Object) string {
+	return hashItem([]byte(obj.GetNamespace() + "/" + obj.GetName()))
+}
+
+// legacyOwnershipLabelValue is the `${Name}.${Namespace}` value written by older versions.
+// Secrets carrying it are migrated on the next reconcile.
+func legacyOwnershipLabelValue(obj client.Object) string {
+	return fmt.Sprintf("%s.%s", obj.GetName(), obj.GetNamespace())
+}
+
+// ownedBy reports whether the OwnershipLabel of secret names obj, migrated or not.
+func ownedBy(secret client.Object, obj client.Object) bool {
+	labelValue, ok := secret.GetLabels()[OwnershipLabel]
+	return ok && (labelValue == ownershipLabelValue(obj) || labelValue == legacyOwnershipLabelValue(obj))
+}
+
+// listOwnedSecrets returns the secrets owned by obj, including the ones not migrated yet.
+func (r *SopsSecretReconciler) listOwnedSecrets(ctx context.Context, obj *secretsv1.SopsSecret) ([]corev1.Secret, error) {
+	labelValues := []string{ownershipLabelValue(obj)}
+	if legacy := legacyOwnershipLabelValue(obj); len(validation.IsValidLabelValue(legacy)) == 0 {
+		labelValues = append(labelValues, legacy)
+	}
+
+	var secrets []corev1.Secret
+	for _, labelValue := range labelValues {
+		secretList := &corev1.SecretList{}
+		if err := r.List(ctx, secretList, client.MatchingLabels{
+			OwnershipLabel: labelValue,
+		}); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secretList.Items...)
+	}
+	return secrets, nil
+}
+
+// pruneStaleTargets deletes the secrets owned by obj that are not in desired and returns them.
+func (r *SopsSecretReconciler) pruneStaleTargets(ctx context.Context, obj *secretsv1.SopsSecret, desired []types.NamespacedName) ([]secretsv1.SopsSecretTargetReference, error) {
+	ownedSecrets, err := r.listOwnedSecrets(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	isDesired := make(map[types.NamespacedName]bool, len(desired))
+	for _, target := range desired {
+		isDesired[target] = true
+	}
+
+	var pruned []secretsv1.SopsSecretTargetReference
+	for i := range ownedSecrets {
+		secret := &ownedSecrets[i]
+		key := client.ObjectKeyFromObject(secret)
+		if isDesired[key] {
+			continue
+		}
+		if err := r.Delete(ctx, secret, client.Preconditions{UID: &secret.UID}); err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			return pruned, err
+		}
+		r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonPruned, "Pruned secret %s, it is no longer a target", key)
+		pruned = append(pruned, secretsv1.SopsSecretTargetReference{Namespace: key.Namespace, Name: key.Name})
+	}
+	return pruned, nil
+}
+
+// secretOwner returns the SopsSecret owning a secret.
+func secretOwner(o client.Object) (types.NamespacedName, bool) {
+	ownershipLabel, ok := o.GetLabels()[OwnershipLabel]
+	if !ok {
+		return types.NamespacedName{}, false
+	}
+
+	annotations := o.GetAnnotations()
+	name, hasName := annotations[OwnerNameAnnotation]
+	namespace, hasNamespace := annotations[OwnerNamespaceAnnotation]
+	if hasName && hasNamespace {
+		return types.NamespacedName{Name: name, Namespace: namespace}, true
+	}
+
+	// Not migrated yet, namespaces can't contain dots so the last one separates the name
+	separator := strings.LastIndex(ownershipLabel, ".")
+	if separator <= 0 || separator == len(ownershipLabel)-1 {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{
+		Name:      ownershipLabel[:separator],
+		Namespace: ownershipLabel[separator+1:],
+	}, true
+}
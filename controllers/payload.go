@@ -0,0 +1,212 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+	"github.com/dhouti/sops-converter/pkg/secretdata"
+)
+
+// decryptedPayload decrypts and parses the Data field of a SopsSecret on first use,
+// so a reconcile fanning out to many namespaces decrypts at most once.
+type decryptedPayload struct {
+	once sync.Once
+	load func() (map[string][]byte, error)
+
+	data map[string][]byte
+	err  error
+}
+
+// get returns a copy of the decrypted data that the caller is free to modify.
+func (p *decryptedPayload) get() (map[string][]byte, error) {
+	p.once.Do(func() {
+		p.data, p.err = p.load()
+	})
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	data := make(map[string][]byte, len(p.data))
+	for k, v := range p.data {
+		data[k] = v
+	}
+	return data, nil
+}
+
+func (r *SopsSecretReconciler) newDecryptedPayload(ctx context.Context, log logr.Logger, obj *secretsv1.SopsSecret) *decryptedPayload {
+	return &decryptedPayload{
+		load: func() (map[string][]byte, error) {
+			return r.loadPayload(ctx, log, obj)
+		},
+	}
+}
+
+// loadPayload returns the decrypted data of obj from the cache, decrypting it on a miss.
+// The cache is keyed by the same checksum stored in SopsChecksumAnnotation and only lives in memory,
+// along with the checksum of the keys of spec.decryptionKeyRef so a payload is never served to a SopsSecret without them.
+func (r *SopsSecretReconciler) loadPayload(ctx context.Context, log logr.Logger, obj *secretsv1.SopsSecret) (map[string][]byte, error) {
+	decryptor, decryptCache := r.decryptState()
+	cacheKey := payloadChecksum(obj)
+	format := obj.Spec.Format
+	if format == "" {
+		format = decrypt.FormatYAML
+	}
+
+	var keys *decrypt.Keys
+	if obj.Spec.DecryptionKeyRef != nil {
+		var keysChecksum string
+		var err error
+		keys, keysChecksum, err = r.decryptionKeys(ctx, obj)
+		if err != nil {
+			log.Error(err, "failed to load decryption keys")
+			r.Recorder.Event(obj, corev1.EventTypeWarning, EventReasonKeyUnavailable, err.Error())
+			return nil, &payloadError{reason: secretsv1.ReasonKeyUnavailable, err: err}
+		}
+		cacheKey += "\nkeys=" + keysChecksum
+	}
+
+	if decryptCache != nil {
+		if cached, ok := decryptCache.Get(cacheKey); ok {
+			return cached.(map[string][]byte), nil
+		}
+	}
+
+	// Decrypt the Data field using Sops, or in-process with only the keys of the SopsSecret
+	start := time.Now()
+	var unencryptedData []byte
+	var err error
+	if keys != nil {
+		unencryptedData, err = decrypt.DecryptWithKeys([]byte(obj.Spec.EncryptedData), format, keys)
+	} else {
+		unencryptedData, err = decryptor.Decrypt([]byte(obj.Spec.EncryptedData), format)
+	}
+	decryptDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		decryptFailuresTotal.WithLabelValues(classifyDecryptError(err)).Inc()
+		log.Error(err, "failed to decrypt data")
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonDecryptFailed, "Failed to decrypt data: %v", err)
+		return nil, &payloadError{reason: secretsv1.ReasonDecryptFailed, err: err}
+	}
+
+	// Convert the decrypted document into secret data, the errors never quote the plaintext
+	data, err := secretdata.Load(unencryptedData, secretdata.Options{
+		Format:        obj.Spec.Format,
+		ValueEncoding: obj.Spec.ValueEncoding,
+		BinaryKey:     obj.Spec.BinaryKey,
+	})
+	if err != nil {
+		log.Error(err, "failed to parse decrypted data")
+		r.Recorder.Event(obj, corev1.EventTypeWarning, EventReasonInvalidPayload, err.Error())
+		return nil, &payloadError{reason: secretsv1.ReasonInvalidPayload, err: err}
+	}
+
+	// Render spec.template.data against the decrypted values
+	data, err = secretdata.Render(obj.Spec.Template.Data, data)
+	if err != nil {
+		log.Error(err, "failed to render template data")
+		r.Recorder.Event(obj, corev1.EventTypeWarning, EventReasonTemplateFailed, err.Error())
+		return nil, &payloadError{reason: secretsv1.ReasonTemplateFailed, err: err}
+	}
+
+	if decryptCache != nil {
+		decryptCache.Add(cacheKey, data, r.DecryptCacheTTL)
+	}
+	return data, nil
+}
+
+// checkPayload runs the checks of obj that don't need its decryption keys. Reconcile runs it before the targets,
+// targets in sync are skipped without decrypting while the namespace annotations may have changed since.
+func (r *SopsSecretReconciler) checkPayload(ctx context.Context, log logr.Logger, obj *secretsv1.SopsSecret) error {
+	// spec.allowUnencrypted isn't part of payloadChecksum, turning it off must still refuse Secrets in sync
+	if !obj.Spec.AllowUnencrypted {
+		format := obj.Spec.Format
+		if format == "" {
+			format = decrypt.FormatYAML
+		}
+		if err := decrypt.CheckEncrypted([]byte(obj.Spec.EncryptedData), format); err != nil {
+			log.Error(err, "encrypted data isn't fully encrypted")
+			r.Recorder.Event(obj, corev1.EventTypeWarning, EventReasonUnencrypted, err.Error())
+			return &payloadError{reason: secretsv1.ReasonUnencrypted, err: err}
+		}
+	}
+
+	// Both checks read the annotations of the namespace, it is fetched once for them
+	namespace, err := r.getNamespace(ctx, obj.Namespace)
+	if err != nil {
+		return err
+	}
+	if err := checkRecipients(obj, namespace); err != nil {
+		log.Error(err, "encrypted data has recipients not allowed in its namespace")
+		r.Recorder.Event(obj, corev1.EventTypeWarning, EventReasonRecipientDenied, err.Error())
+		return &payloadError{reason: secretsv1.ReasonRecipientDenied, err: err}
+	}
+	if obj.MissingDecryptionKeyRef(namespace.Annotations) {
+		err := fmt.Errorf("namespace %s requires spec.decryptionKeyRef, the keys of the controller aren't used", obj.Namespace)
+		log.Error(err, "namespace requires spec.decryptionKeyRef")
+		r.Recorder.Event(obj, corev1.EventTypeWarning, EventReasonKeyUnavailable, err.Error())
+		return &payloadError{reason: secretsv1.ReasonKeyUnavailable, err: err}
+	}
+	return nil
+}
+
+// checkRecipients fails when the encrypted data has master keys secretsv1.AllowedRecipientsAnnotation,
+// on the namespace of obj, doesn't list.
+func checkRecipients(obj *secretsv1.SopsSecret, namespace *corev1.Namespace) error {
+	disallowed, err := obj.DisallowedRecipients(namespace.Annotations)
+	if err != nil {
+		return fmt.Errorf("unable to read the recipients of the encrypted data: %v", err)
+	}
+	if len(disallowed) > 0 {
+		return fmt.Errorf("encrypted to master keys not allowed in namespace %s: %s", obj.Namespace, strings.Join(disallowed, ", "))
+	}
+	return nil
+}
+
+// payloadChecksum identifies the decrypted data of obj, it is stored in SopsChecksumAnnotation.
+// Options only change it when set, so existing Secrets keep their checksum.
+func payloadChecksum(obj *secretsv1.SopsSecret) string {
+	payload := obj.Spec.EncryptedData
+	if obj.Spec.ValueEncoding != "" {
+		payload += "\nvalueEncoding=" + obj.Spec.ValueEncoding
+	}
+	if obj.Spec.Format != "" {
+		payload += "\nformat=" + obj.Spec.Format
+	}
+	if obj.Spec.BinaryKey != "" {
+		payload += "\nbinaryKey=" + obj.Spec.BinaryKey
+	}
+	if ref := obj.Spec.DecryptionKeyRef; ref != nil {
+		payload += "\ndecryptionKeyRef=" + ref.Name + "/" + ref.Key
+	}
+	if len(obj.Spec.Template.Data) > 0 {
+		// encoding/json sorts map keys, so the checksum is stable
+		templates, _ := json.Marshal(obj.Spec.Template.Data)
+		payload += "\ntemplateData=" + string(templates)
+	}
+	return hashItem([]byte(payload))
+}
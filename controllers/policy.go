@@ -0,0 +1,174 @@
+/*
+Copyright © 2020 Rex Via  l.rex.via@gmail.com
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+)
+
+// AllowedSourceNamespacesAnnotation on a namespace lists the namespaces, comma separated or "*",
+// whose SopsSecrets may write Secrets to it when the target policy is enforced.
+const AllowedSourceNamespacesAnnotation = "secrets.dhouti.dev/allowed-source-namespaces"
+
+// deniedTargets returns the targets obj may not write to. Without EnforceTargetPolicy every target is allowed,
+// otherwise a SopsSecret may only write outside of its own namespace when the target namespace annotation
+// or a SopsSecretPolicy allows it.
+func (r *SopsSecretReconciler) deniedTargets(ctx context.Context, obj *secretsv1.SopsSecret, desired []types.NamespacedName) (map[types.NamespacedName]bool, error) {
+	denied := make(map[types.NamespacedName]bool)
+	if !r.EnforceTargetPolicy {
+		return denied, nil
+	}
+
+	var policies []secretsv1.SopsSecretPolicy
+	var source *corev1.Namespace
+	for _, target := range desired {
+		if target.Namespace == obj.Namespace {
+			continue
+		}
+
+		namespace, err := r.getNamespace(ctx, target.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if namespaceAllowsSource(namespace, obj.Namespace) {
+			continue
+		}
+
+		// Only looked up when a namespace annotation isn't enough
+		if source == nil {
+			if source, err = r.getNamespace(ctx, obj.Namespace); err != nil {
+				return nil, err
+			}
+			policyList := &secretsv1.SopsSecretPolicyList{}
+			if err = r.List(ctx, policyList); err != nil {
+				return nil, err
+			}
+			policies = policyList.Items
+		}
+
+		allowed := false
+		for i := range policies {
+			if policyAllows(&policies[i].Spec, source, namespace, target.Name) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			denied[target] = true
+		}
+	}
+	return denied, nil
+}
+
+// getNamespace returns the namespace called name, a missing namespace has no labels nor annotations.
+func (r *SopsSecretReconciler) getNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return nil, err
+		}
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	return namespace, nil
+}
+
+// namespaceAllowsSource reports whether AllowedSourceNamespacesAnnotation of namespace lists source.
+func namespaceAllowsSource(namespace *corev1.Namespace, source string) bool {
+	allowed, ok := namespace.Annotations[AllowedSourceNamespacesAnnotation]
+	if !ok {
+		return false
+	}
+	return matchesNamespace(strings.Split(allowed, ","), nil, source, nil)
+}
+
+// policyAllows reports whether policy lets the SopsSecrets of source write the Secret name in target.
+func policyAllows(policy *secretsv1.SopsSecretPolicySpec, source, target *corev1.Namespace, name string) bool {
+	if !matchesNamespace(policy.SourceNamespaces, policy.SourceNamespaceSelector, source.Name, source.Labels) {
+		return false
+	}
+	for _, rule := range policy.Targets {
+		if !matchesNamespace(rule.Namespaces, rule.NamespaceSelector, target.Name, target.Labels) {
+			continue
+		}
+		if len(rule.Names) == 0 {
+			return true
+		}
+		for _, pattern := range rule.Names {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesNamespace reports whether the namespace is listed in names, "*" matching every namespace, or matched by selector.
+func matchesNamespace(names []string, selector *metav1.LabelSelector, name string, namespaceLabels map[string]string) bool {
+	for _, listed := range names {
+		listed = strings.TrimSpace(listed)
+		if listed == "*" || listed == name {
+			return true
+		}
+	}
+	if selector == nil {
+		return false
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		// An invalid selector never matches, failing closed
+		return false
+	}
+	return labelSelector.Matches(labels.Set(namespaceLabels))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mapPolicyToSopsSecrets reconciles every SopsSecret when a policy changes, any of them may be allowed or denied a target.
+func (r *SopsSecretReconciler) mapPolicyToSopsSecrets(_ client.Object) []reconcile.Request {
+	sopsSecretList := &secretsv1.SopsSecretList{}
+	if err := r.List(context.Background(), sopsSecretList); err != nil {
+		r.Log.Error(err, "unable to list sopssecrets")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(sopsSecretList.Items))
+	for _, sopsSecret := range sopsSecretList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&sopsSecret),
+		})
+	}
+	return requests
+}
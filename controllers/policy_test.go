@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
+)
+
+func newNamespace(name string, labels, annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+}
+
+func TestPolicyAllows(t *testing.T) {
+	teamA := newNamespace("team-a", map[string]string{"tenant": "a"}, nil)
+	teamB := newNamespace("team-b", map[string]string{"tenant": "b"}, nil)
+	shared := newNamespace("shared", map[string]string{"shared": "true"}, nil)
+
+	policy := &secretsv1.SopsSecretPolicySpec{
+		SourceNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+		Targets: []secretsv1.SopsSecretPolicyTarget{{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"shared": "true"}},
+			Names:             []string{"team-a-*"},
+		}},
+	}
+
+	tests := []struct {
+		name           string
+		source, target *corev1.Namespace
+		secret         string
+		allowed        bool
+	}{
+		{"matching source, namespace and name", teamA, shared, "team-a-db", true},
+		{"name not matching", teamA, shared, "team-b-db", false},
+		{"target namespace not matching", teamA, teamB, "team-a-db", false},
+		{"source not matching", teamB, shared, "team-a-db", false},
+	}
+	for _, test := range tests {
+		if allowed := policyAllows(policy, test.source, test.target, test.secret); allowed != test.allowed {
+			t.Errorf("%s: expected %v, got %v", test.name, test.allowed, allowed)
+		}
+	}
+
+	wildcard := &secretsv1.SopsSecretPolicySpec{
+		SourceNamespaces: []string{"*"},
+		Targets:          []secretsv1.SopsSecretPolicyTarget{{Namespaces: []string{"team-b"}}},
+	}
+	if !policyAllows(wildcard, teamA, teamB, "anything") {
+		t.Error("expected the wildcard source and empty names to allow every secret of team-b")
+	}
+	if policyAllows(wildcard, teamA, shared, "anything") {
+		t.Error("expected the policy to deny namespaces it doesn't list")
+	}
+}
+
+func TestNamespaceAllowsSource(t *testing.T) {
+	tests := []struct {
+		annotations map[string]string
+		allowed     bool
+	}{
+		{nil, false},
+		{map[string]string{AllowedSourceNamespacesAnnotation: "team-b, team-a"}, true},
+		{map[string]string{AllowedSourceNamespacesAnnotation: "*"}, true},
+		{map[string]string{AllowedSourceNamespacesAnnotation: "team-b"}, false},
+		{map[string]string{AllowedSourceNamespacesAnnotation: ""}, false},
+	}
+	for _, test := range tests {
+		namespace := newNamespace("shared", nil, test.annotations)
+		if allowed := namespaceAllowsSource(namespace, "team-a"); allowed != test.allowed {
+			t.Errorf("%v: expected %v, got %v", test.annotations, test.allowed, allowed)
+		}
+	}
+}
@@ -21,30 +21,35 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/dhouti/sops-converter/pkg/decrypt"
-	"go.uber.org/atomic"
-	"os"
 
 	"reflect"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
-	"strconv"
-	"strings"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
-	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	secretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -54,76 +59,138 @@ const (
 	SecretChecksumAnnotation = "secrets.dhouti.dev/secretChecksum"
 	SopsChecksumAnnotation   = "secrets.dhouti.dev/sopsChecksum"
 	OwnershipLabel           = "secrets.dhouti.dev/owned-by-controller"
+	OwnerNameAnnotation      = "secrets.dhouti.dev/owner-name"
+	OwnerNamespaceAnnotation = "secrets.dhouti.dev/owner-namespace"
 	DeletionFinalizer        = "secrets.dhouti.dev/garbageCollection"
 )
 
-var lock sync.Mutex
+// Event reasons emitted on SopsSecret objects.
+// Event messages never contain decrypted values.
+const (
+	EventReasonDecryptFailed   = "DecryptFailed"
+	EventReasonInvalidPayload  = "InvalidPayload"
+	EventReasonTemplateFailed  = "TemplateFailed"
+	EventReasonKeyUnavailable  = "KeyUnavailable"
+	EventReasonTargetDenied    = "TargetDenied"
+	EventReasonRecipientDenied = "RecipientDenied"
+	EventReasonUnencrypted     = "Unencrypted"
+	EventReasonCreated         = "Created"
+	EventReasonUpdated         = "Updated"
+	EventReasonDriftCorrected  = "DriftCorrected"
+	EventReasonSyncFailed      = "SyncFailed"
+	EventReasonDeleted         = "Deleted"
+	EventReasonPruned          = "Pruned"
+)
+
+// errSecretNotOwned is returned by ReconcileNamespace when the destination
+// Secret already exists without the ownership label of the SopsSecret and is left untouched.
+var errSecretNotOwned = errors.New("secret exists and is not owned by this SopsSecret")
+
+// payloadError marks a failure to produce the decrypted payload, as opposed to
+// a failure to write the target Secret.
+type payloadError struct {
+	reason string
+	err    error
+}
+
+func (e *payloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *payloadError) Unwrap() error {
+	return e.err
+}
 
 // SopsSecretReconciler reconciles a SopsSecret object
 type SopsSecretReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 
 	decrypt.Decryptor
-	finalizersDisabled *atomic.Bool
+
+	// DisableFinalizers retains the generated Secrets of every SopsSecret regardless of spec.deletionPolicy,
+	// and removes the finalizer from every SopsSecret. It is set from DISABLE_FINALIZERS before uninstalling.
+	DisableFinalizers bool
+
+	// EnforceTargetPolicy only lets SopsSecrets write outside of their own namespace when a namespace annotation
+	// or a SopsSecretPolicy allows it.
+	EnforceTargetPolicy bool
+
+	// DecryptCacheSize is the number of decrypted payloads kept in memory, 0 disables the cache.
+	DecryptCacheSize int
+	// DecryptCacheTTL is how long a decrypted payload is kept in memory.
+	DecryptCacheTTL time.Duration
+
+	// MaxConcurrentReconciles is the number of SopsSecrets reconciled in parallel, 1 when unset.
+	MaxConcurrentReconciles int
+	// RateLimiter limits how fast failed SopsSecrets are retried, the controller-runtime default when unset.
+	RateLimiter ratelimiter.RateLimiter
+
+	// WedgedTimeout is how long a reconcile may run before LivezCheck fails, 0 disables the check.
+	WedgedTimeout time.Duration
+	inFlight      inFlightTracker
+
+	// mu guards the decryptor and the cache, which are swapped by InjectDecryptor while reconciling.
+	mu           sync.RWMutex
+	decryptCache *cache.LRUExpireCache
 }
 
 func (r *SopsSecretReconciler) InjectDecryptor(d decrypt.Decryptor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.Decryptor = d
+	// Plaintext cached for the previous decryptor may not be reproducible with the new one
+	r.decryptCache = r.newDecryptCache()
+}
+
+// ResetDecryptCache drops every cached payload, e.g. after the keys of the decryptor changed
+// so data they can no longer decrypt isn't served from the cache.
+func (r *SopsSecretReconciler) ResetDecryptCache() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decryptCache = r.newDecryptCache()
+}
+
+// decryptState returns the decryptor and the cache of decrypted payloads, the cache is nil when disabled.
+func (r *SopsSecretReconciler) decryptState() (decrypt.Decryptor, *cache.LRUExpireCache) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Decryptor, r.decryptCache
 }
 
 // +kubebuilder:rbac:groups=secrets.dhouti.dev,resources=sopssecrets,verbs="*"
 // +kubebuilder:rbac:groups=secrets.dhouti.dev,resources=sopssecrets/status,verbs="*"
 // +kubebuilder:rbac:groups="",resources=secrets,verbs="*"
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=secrets.dhouti.dev,resources=sopssecretpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
 
 func (r *SopsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("sopssecret", req.NamespacedName)
-	r.initReconciler()
+	defer r.inFlight.track(req.NamespacedName)()
 
 	// Attempt to fetch SopsSecret object. Short circuit if not exists
-	obj := &secretsv1beta1.SopsSecret{}
+	obj := &secretsv1.SopsSecret{}
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
 		if k8serrors.IsNotFound(err) {
+			notInSync.forget(req.NamespacedName)
 			err = nil
 		}
 		return ctrl.Result{}, err
 	}
 
-	// If namespaces not set use namespace
-	if len(obj.Spec.Template.Namespaces) == 0 {
-		obj.Spec.Template.Namespaces = []string{
-			obj.Namespace,
-		}
-	}
-
-	r.checkFinalizersDisabled(obj)
-
-	// Cleanup secrets in namespaces no longer in spec.
-	ownershipLabelValue := fmt.Sprintf("%s.%s", obj.Name, obj.Namespace)
-	secretList := &corev1.SecretList{}
-	if err := r.List(ctx, secretList, client.MatchingLabels{
-		OwnershipLabel: ownershipLabelValue,
-	}); err != nil {
+	// Resolve the full set of (namespace, name) the secret is written to
+	desired, err := r.desiredTargets(ctx, obj)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	for _, secretListItem := range secretList.Items {
-		var foundItem bool
-		for _, curNamespace := range obj.Spec.Template.Namespaces {
-			if secretListItem.ObjectMeta.Namespace == curNamespace {
-				foundItem = true
-			}
-		}
-		if !foundItem {
-			if err := r.Delete(ctx, &secretListItem); err != nil && !k8serrors.IsNotFound(err) {
-				return ctrl.Result{}, err
-			}
-		}
-	}
-
-	// Add finalizer if not set and not currently being deleted
-	if obj.GetDeletionTimestamp().IsZero() && !controllerutil.ContainsFinalizer(obj, DeletionFinalizer) && !r.finalizersDisabled.Load() {
+	// Add finalizer if not set, not currently being deleted and the secrets are deleted with obj
+	retainSecrets := r.retainSecrets(obj)
+	if obj.GetDeletionTimestamp().IsZero() && !controllerutil.ContainsFinalizer(obj, DeletionFinalizer) && !retainSecrets {
 		controllerutil.AddFinalizer(obj, DeletionFinalizer)
 		if err := r.Update(ctx, obj); err != nil {
 			return ctrl.Result{}, fmt.Errorf("unable to update finalizers %v", err)
@@ -131,8 +198,8 @@ func (r *SopsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil // After add finalizer, requeue may not required ???
 	}
 
-	// Delete finalizer if finalizers are disabled
-	if r.finalizersDisabled.Load() && controllerutil.ContainsFinalizer(obj, DeletionFinalizer) {
+	// Delete finalizer if the secrets outlive obj
+	if retainSecrets && controllerutil.ContainsFinalizer(obj, DeletionFinalizer) {
 		controllerutil.RemoveFinalizer(obj, DeletionFinalizer)
 		if err := r.Update(ctx, obj); err != nil {
 			return ctrl.Result{}, fmt.Errorf("unable to remove finalizers %v", err)
@@ -140,69 +207,170 @@ func (r *SopsSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil // Owned objects are automatically garbage collected, Return and don't requeue ???
 	}
 
-	targetName := obj.Name
-	if obj.Spec.Template.Name != "" {
-		targetName = obj.Spec.Template.Name
+	// Cleanup owned secrets that are no longer a target, e.g. after the name or namespaces changed
+	pruned, err := r.pruneStaleTargets(ctx, obj, desired)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
+	// Nothing is written to nor deleted from the targets the policy denies
+	denied, err := r.deniedTargets(ctx, obj, desired)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Object is being deleted, delete every target before letting it go
+	if !obj.GetDeletionTimestamp().IsZero() {
+		notInSync.forget(req.NamespacedName)
+		return ctrl.Result{}, r.finalize(ctx, log, obj, desired, denied)
+	}
+
+	payload := r.newDecryptedPayload(ctx, log, obj)
 	var requeue bool
-	for _, targetNamespace := range obj.Spec.Template.Namespaces {
-		secretDestination := types.NamespacedName{
-			Name:      targetName,
-			Namespace: targetNamespace,
+	var errs []error
+
+	// Targets in sync never decrypt the payload, so the checks that don't need to are run here
+	checkErr := r.checkPayload(ctx, log, obj)
+	if checkErr != nil {
+		errs = append(errs, checkErr)
+	}
+
+	targets := make([]secretsv1.SopsSecretTargetStatus, 0, len(desired))
+	for _, secretDestination := range desired {
+		target := secretsv1.SopsSecretTargetStatus{
+			Name:      secretDestination.Name,
+			Namespace: secretDestination.Namespace,
 		}
-		res, err := r.ReconcileNamespace(ctx, log, obj, secretDestination)
-		// If there's an error return immediately
-		if err != nil {
-			return res, err
+		if denied[secretDestination] {
+			target.Denied = true
+			target.Message = "denied by the target policy"
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonTargetDenied, "Secret %s is denied by the target policy", secretDestination)
+			targets = append(targets, target)
+			continue
 		}
+		if checkErr != nil {
+			// Secrets already written are left as is, like when decrypting fails
+			target.Message = checkErr.Error()
+			targets = append(targets, target)
+			continue
+		}
+
+		res, err := r.ReconcileNamespace(ctx, log, obj, payload, secretDestination)
+		switch {
+		case err == errSecretNotOwned:
+			target.Message = err.Error()
+		case err != nil:
+			// Keep going so every target gets reported, the error is returned below
+			target.Message = err.Error()
+			errs = append(errs, err)
+		default:
+			target.Synced = true
+		}
+		targets = append(targets, target)
 
 		if res.Requeue {
 			requeue = true
 		}
 	}
 
-	return ctrl.Result{Requeue: requeue}, nil
+	if err := r.updateStatus(ctx, obj, targets, pruned, errs); err != nil {
+		errs = append(errs, fmt.Errorf("unable to update status: %v", err))
+	}
+
+	return ctrl.Result{Requeue: requeue}, utilerrors.NewAggregate(errs)
+}
+
+// updateStatus records the outcome of a reconcile in the status subresource.
+// Pruned targets accumulate until the generation changes.
+func (r *SopsSecretReconciler) updateStatus(ctx context.Context, obj *secretsv1.SopsSecret, targets []secretsv1.SopsSecretTargetStatus, pruned []secretsv1.SopsSecretTargetReference, errs []error) error {
+	generation := obj.GetGeneration()
+
+	decrypted := metav1.Condition{
+		Type:               secretsv1.ConditionDecrypted,
+		Status:             metav1.ConditionTrue,
+		Reason:             secretsv1.ReasonReconciled,
+		Message:            "Payload decrypted",
+		ObservedGeneration: generation,
+	}
+	for _, err := range errs {
+		var payloadErr *payloadError
+		if errors.As(err, &payloadErr) {
+			decrypted.Status = metav1.ConditionFalse
+			decrypted.Reason = payloadErr.reason
+			decrypted.Message = payloadErr.Error()
+			break
+		}
+	}
+
+	synced := metav1.Condition{
+		Type:               secretsv1.ConditionSynced,
+		Status:             metav1.ConditionTrue,
+		Reason:             secretsv1.ReasonReconciled,
+		Message:            fmt.Sprintf("%d of %d target secrets synced", len(targets), len(targets)),
+		ObservedGeneration: generation,
+	}
+	var syncedCount, deniedCount int
+	for _, target := range targets {
+		if target.Synced {
+			syncedCount++
+		}
+		if target.Denied {
+			deniedCount++
+		}
+	}
+	if syncedCount != len(targets) {
+		synced.Status = metav1.ConditionFalse
+		synced.Reason = secretsv1.ReasonSyncFailed
+		synced.Message = fmt.Sprintf("%d of %d target secrets synced", syncedCount, len(targets))
+	}
+	if deniedCount > 0 {
+		synced.Reason = secretsv1.ReasonTargetDenied
+		synced.Message += fmt.Sprintf(", %d denied by the target policy", deniedCount)
+	}
+
+	ready := metav1.Condition{
+		Type:               secretsv1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             secretsv1.ReasonReconciled,
+		Message:            "All target secrets are in sync",
+		ObservedGeneration: generation,
+	}
+	if decrypted.Status != metav1.ConditionTrue {
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, decrypted.Reason, decrypted.Message
+	} else if synced.Status != metav1.ConditionTrue {
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, synced.Reason, synced.Message
+	}
+
+	meta.SetStatusCondition(&obj.Status.Conditions, decrypted)
+	meta.SetStatusCondition(&obj.Status.Conditions, synced)
+	meta.SetStatusCondition(&obj.Status.Conditions, ready)
+	if obj.Status.ObservedGeneration != generation {
+		obj.Status.PrunedTargets = nil
+	}
+	obj.Status.PrunedTargets = append(obj.Status.PrunedTargets, pruned...)
+	obj.Status.ObservedGeneration = generation
+	obj.Status.Targets = targets
+	if ready.Status == metav1.ConditionTrue {
+		now := metav1.Now()
+		obj.Status.LastSyncTime = &now
+	}
+	notInSync.set(client.ObjectKeyFromObject(obj), ready.Status == metav1.ConditionTrue)
+
+	return r.Status().Update(ctx, obj)
 }
 
-func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.Logger, obj *secretsv1beta1.SopsSecret, secretDestination types.NamespacedName) (ctrl.Result, error) {
+func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.Logger, obj *secretsv1.SopsSecret, payload *decryptedPayload, secretDestination types.NamespacedName) (ctrl.Result, error) {
 	// Fetch the secret
-	// If ownership label not present on existing secret short circuit
+	// If the ownership label of obj is not present on existing secret short circuit
 	fetchSecret := &corev1.Secret{}
 	err := r.Get(ctx, secretDestination, fetchSecret)
 	secretNotFound := k8serrors.IsNotFound(err)
 	if err != nil && !secretNotFound {
 		return ctrl.Result{}, err
 	}
-	if !secretNotFound {
-		_, ok := fetchSecret.Labels[OwnershipLabel]
-		if !ok {
-			// The secret does not have the ownership label, exit
-			return ctrl.Result{}, nil
-		}
-	}
-
-	dt := obj.GetDeletionTimestamp()
-	// Object is being deleted
-	if !dt.IsZero() {
-		if controllerutil.ContainsFinalizer(obj, DeletionFinalizer) {
-			// Delete the secret if it exists and finalizers enabled
-			if !secretNotFound && !r.finalizersDisabled.Load() {
-				err = r.Delete(ctx, fetchSecret)
-				if err != nil {
-					return ctrl.Result{}, err
-				}
-			}
-
-			// Remove the finalizer and exit
-			controllerutil.RemoveFinalizer(obj, DeletionFinalizer)
-			if err = r.Update(ctx, obj); err != nil {
-				return ctrl.Result{}, fmt.Errorf("unable to remove finalizer, error: %v, while secretNotFound =  %t", err, secretNotFound)
-			}
-			log.Info("finalizer was removed...")
-		}
-		// Stop reconciliation as the item is being deleted
-		return ctrl.Result{}, nil
+	if !secretNotFound && !ownedBy(fetchSecret, obj) {
+		// The secret has no ownership label or belongs to another SopsSecret, exit
+		return ctrl.Result{}, errSecretNotOwned
 	}
 
 	// Calculate hashes of both objects to see if they are in desired state.
@@ -212,7 +380,7 @@ func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.
 	}
 
 	currentSecretChecksum := hashItem(secretDataBytes)
-	currentSopsChecksum := hashItem([]byte(obj.Data))
+	currentSopsChecksum := payloadChecksum(obj)
 
 	// Handle annotations from template
 	secretAnnotations := make(map[string]string)
@@ -221,6 +389,8 @@ func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.
 	}
 	secretAnnotations[SecretChecksumAnnotation] = currentSecretChecksum
 	secretAnnotations[SopsChecksumAnnotation] = currentSopsChecksum
+	secretAnnotations[OwnerNameAnnotation] = obj.Name
+	secretAnnotations[OwnerNamespaceAnnotation] = obj.Namespace
 
 	// Handle labels from template
 	secretLabels := make(map[string]string)
@@ -228,7 +398,7 @@ func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.
 		secretLabels = obj.Spec.Template.Labels
 	}
 
-	secretLabels[OwnershipLabel] = fmt.Sprintf("%s.%s", obj.Name, obj.Namespace)
+	secretLabels[OwnershipLabel] = ownershipLabelValue(obj)
 
 	existingSecretChecksum, hasSecretChecksum := fetchSecret.Annotations[SecretChecksumAnnotation]
 	existingSopsChecksum, hasSopsChecksum := fetchSecret.Annotations[SopsChecksumAnnotation]
@@ -239,30 +409,16 @@ func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.
 		reflect.DeepEqual(fetchSecret.Labels, secretLabels) {
 		// That's one big if
 		log.Info("Objects matched, skipping.")
+		secretOperationsTotal.WithLabelValues(secretOperationSkipped).Inc()
 		return ctrl.Result{}, nil
 	}
 
-	// Decrypt the Data field using Sops
-	unencryptedData, err := r.Decrypt([]byte(obj.Data), "yaml")
-	if err != nil {
-		log.Error(err, "failed to decrypt data")
-		return ctrl.Result{}, err
-	}
-
-	// Convert decryted secret into map[string]string, sadly cannot unmarshal directly into []byte
-	secretDataStrings := make(map[string]string)
-	err = yaml.Unmarshal(unencryptedData, &secretDataStrings)
+	// Decrypt the Data field, this happens at most once per reconcile
+	generatedSecretData, err := payload.get()
 	if err != nil {
-		log.Error(err, "failed to unmarshal decrypted data")
 		return ctrl.Result{}, err
 	}
 
-	// Convert map[string]string to map[string][]byte for compatibility with corev1.Secret
-	generatedSecretData := make(map[string][]byte)
-	for k, v := range secretDataStrings {
-		generatedSecretData[k] = []byte(v)
-	}
-
 	// Add back ignored keys from live secret
 	ignoredKeys := obj.Spec.IgnoredKeys
 	if len(ignoredKeys) > 0 {
@@ -276,6 +432,10 @@ func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.
 		}
 	}
 
+	// The payload did not change but the live data did, it was modified outside the controller
+	drifted := !secretNotFound && existingSopsChecksum == currentSopsChecksum &&
+		!reflect.DeepEqual(fetchSecret.Data, generatedSecretData)
+
 	// Prevents an unnecessary reconcile on new objects
 	secretDataBytes, err = json.Marshal(generatedSecretData)
 	if err != nil {
@@ -291,10 +451,10 @@ func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.
 		},
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, generatedSecret, func() error {
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, generatedSecret, func() error {
 		generatedSecret.Annotations = secretAnnotations
 		generatedSecret.Labels = secretLabels
-		generatedSecret.Type = obj.Type
+		generatedSecret.Type = obj.Spec.Type
 
 		generatedSecret.Data = generatedSecretData
 		return nil
@@ -302,16 +462,122 @@ func (r *SopsSecretReconciler) ReconcileNamespace(ctx context.Context, log logr.
 
 	if err != nil {
 		log.Error(err, "failed to apply changes to secret")
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonSyncFailed, "Failed to apply secret %s: %v", secretDestination, err)
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case op == controllerutil.OperationResultCreated:
+		secretOperationsTotal.WithLabelValues(secretOperationCreated).Inc()
+		r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonCreated, "Created secret %s", secretDestination)
+	case op == controllerutil.OperationResultUpdated && drifted:
+		secretOperationsTotal.WithLabelValues(secretOperationUpdated).Inc()
+		secretDriftTotal.Inc()
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, EventReasonDriftCorrected, "Secret %s was modified outside of the controller, overwrote it", secretDestination)
+	case op == controllerutil.OperationResultUpdated:
+		secretOperationsTotal.WithLabelValues(secretOperationUpdated).Inc()
+		r.Recorder.Eventf(obj, corev1.EventTypeNormal, EventReasonUpdated, "Updated secret %s", secretDestination)
+	}
+
+	return ctrl.Result{}, nil
+
+}
+
+// desiredTargets returns the secrets obj is written to, one per target namespace.
+func (r *SopsSecretReconciler) desiredTargets(ctx context.Context, obj *secretsv1.SopsSecret) ([]types.NamespacedName, error) {
+	namespaces, err := r.targetNamespaces(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	targetName := obj.Name
+	if obj.Spec.Template.Name != "" {
+		targetName = obj.Spec.Template.Name
+	}
+	targets := make([]types.NamespacedName, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		targets = append(targets, types.NamespacedName{Name: targetName, Namespace: namespace})
 	}
+	return targets, nil
+}
+
+// targetNamespaces returns the namespaces listed in the template and the ones matching its namespace selector.
+func (r *SopsSecretReconciler) targetNamespaces(ctx context.Context, obj *secretsv1.SopsSecret) ([]string, error) {
+	namespaces := obj.Spec.Template.Namespaces
+	if obj.Spec.Template.NamespaceSelector == nil {
+		if len(namespaces) == 0 {
+			return []string{obj.Namespace}, nil
+		}
+		return namespaces, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(obj.Spec.Template.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector: %v", err)
+	}
+
+	namespaceList := &corev1.NamespaceList{}
+	if err = r.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, namespace := range namespaceList.Items {
+		if namespace.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+		selected = append(selected, namespace.Name)
+	}
+	sort.Strings(selected)
+
+	result := append([]string{}, namespaces...)
+	for _, namespace := range selected {
+		var found bool
+		for _, curNamespace := range namespaces {
+			if namespace == curNamespace {
+				found = true
+			}
+		}
+		if !found {
+			result = append(result, namespace)
+		}
+	}
+	return result, nil
+}
 
-	return ctrl.Result{}, err
+// mapNamespaceToSopsSecrets enqueues every SopsSecret with a namespace selector,
+// the namespace may have started or stopped matching any of them, and the SopsSecrets depending on its annotations.
+func (r *SopsSecretReconciler) mapNamespaceToSopsSecrets(o client.Object) []reconcile.Request {
+	sopsSecretList := &secretsv1.SopsSecretList{}
+	if err := r.List(context.Background(), sopsSecretList); err != nil {
+		r.Log.Error(err, "unable to list sopssecrets", "namespace", o.GetName())
+		return nil
+	}
 
+	var requests []reconcile.Request
+	for _, sopsSecret := range sopsSecretList.Items {
+		// The allowed recipients depend on the annotations of the namespace of the SopsSecret,
+		// the target policy on the annotations and labels of the source and target namespaces
+		dependsOn := sopsSecret.Namespace == o.GetName() ||
+			(r.EnforceTargetPolicy && containsString(sopsSecret.Spec.Template.Namespaces, o.GetName()))
+		if sopsSecret.Spec.Template.NamespaceSelector == nil && !dependsOn {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKeyFromObject(&sopsSecret),
+		})
+	}
+	return requests
 }
 
 func (r *SopsSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&secretsv1beta1.SopsSecret{}).
-		WithEventFilter(predicate.Funcs{
+	r.initReconciler()
+	b := ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.RateLimiter,
+		}).
+		For(&secretsv1.SopsSecret{}, builder.WithPredicates(predicate.Funcs{
 			UpdateFunc: func(e event.UpdateEvent) bool {
 				oldGeneration := e.ObjectOld.GetGeneration()
 				newGeneration := e.ObjectNew.GetGeneration()
@@ -327,32 +593,31 @@ func (r *SopsSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				// Suppress Delete events to avoid filtering them out in the Reconcile function
 				return false
 			},
-		}).
+		})).
 		// Use a WatchMap over an Ownerref, this should allow for safe deletion of the CRD and all objects without garbage collecting all of the secrets.
 		// Would require scaling down the controller first.
 		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(
 			func(o client.Object) []reconcile.Request {
-				ownershipLabel, ok := o.GetLabels()[OwnershipLabel]
-				if !ok {
-					return nil
-				}
+				// Secrets holding the decryption keys of SopsSecrets
+				requests := r.mapKeySecretToSopsSecrets(o)
 
-				splitOwnershipLabel := strings.Split(ownershipLabel, ".")
-				if len(splitOwnershipLabel) != 2 {
-					return nil
+				owner, ok := secretOwner(o)
+				if !ok {
+					return requests
 				}
 
-				return []reconcile.Request{
-					{
-						NamespacedName: types.NamespacedName{
-							Name:      splitOwnershipLabel[0],
-							Namespace: splitOwnershipLabel[1],
-						},
-					},
-				}
+				return append(requests, reconcile.Request{
+					NamespacedName: owner,
+				})
 			},
 		)).
-		Complete(r)
+		// Namespaces starting or stopping to match a namespace selector
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.mapNamespaceToSopsSecrets))
+	// The policies are only read when enforced, so the CRD is optional otherwise
+	if r.EnforceTargetPolicy {
+		b = b.Watches(&source.Kind{Type: &secretsv1.SopsSecretPolicy{}}, handler.EnqueueRequestsFromMapFunc(r.mapPolicyToSopsSecrets))
+	}
+	return b.Complete(r)
 }
 
 func hashItem(data []byte) string {
@@ -361,23 +626,36 @@ func hashItem(data []byte) string {
 	return encodedHash
 }
 
-func (r *SopsSecretReconciler) checkFinalizersDisabled(obj *secretsv1beta1.SopsSecret) {
-	lock.Lock()
-	defer lock.Unlock()
-	finalizersDisabledByEnv, _ := strconv.ParseBool(os.Getenv("DISABLE_FINALIZERS"))
-	if finalizersDisabledByEnv || obj.Spec.SkipFinalizers {
-		r.finalizersDisabled.Store(true)
+// retainSecrets reports whether the generated secrets of obj are kept when it is deleted.
+func (r *SopsSecretReconciler) retainSecrets(obj *secretsv1.SopsSecret) bool {
+	if r.DisableFinalizers {
+		return true
+	}
+	switch obj.Spec.DeletionPolicy {
+	case secretsv1.DeletionPolicyRetain:
+		return true
+	case secretsv1.DeletionPolicyDelete:
+		return false
 	}
+	return obj.Spec.SkipFinalizers
 }
 
+// initReconciler sets the defaults of the reconciler, it runs once before the workers start.
 func (r *SopsSecretReconciler) initReconciler() {
-	lock.Lock()
-	defer lock.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	// If not otherwise defined, default to the real decrypt func.
 	if r.Decryptor == nil {
 		r.Decryptor = &decrypt.SopsDecrytor{}
 	}
-	if r.finalizersDisabled == nil {
-		r.finalizersDisabled = atomic.NewBool(false)
+	if r.decryptCache == nil {
+		r.decryptCache = r.newDecryptCache()
+	}
+}
+
+func (r *SopsSecretReconciler) newDecryptCache() *cache.LRUExpireCache {
+	if r.DecryptCacheSize <= 0 {
+		return nil
 	}
+	return cache.NewLRUExpireCache(r.DecryptCacheSize)
 }
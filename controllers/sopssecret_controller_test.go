@@ -26,12 +26,16 @@ import (
 
 	. "github.com/onsi/gomega"
 
-	sopssecretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
+	sopssecretsv1 "github.com/dhouti/sops-converter/api/v1"
+	"github.com/dhouti/sops-converter/controllers"
 	decryptmocks "github.com/dhouti/sops-converter/pkg/decrypt/mocks"
+	"github.com/dhouti/sops-converter/pkg/secretdata"
 	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var currentNamespace string
@@ -67,7 +71,7 @@ var _ = Describe("sopssecret controller", func() {
 		}
 
 		Eventually(func() error {
-			fetchSopsSecret := &sopssecretsv1beta1.SopsSecret{}
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
 			return k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
 		}, 30).Should(HaveOccurred())
 	})
@@ -75,7 +79,7 @@ var _ = Describe("sopssecret controller", func() {
 	Context("fail to complete reconcile", func() {
 		It("Fails to parse yaml", func() {
 			newSecret := getTestSopsSecret()
-			newSecret.Data = "this isn't yaml, this will fail"
+			newSecret.Spec.EncryptedData = "this isn't yaml, this will fail"
 
 			err := k8sClient.Create(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
@@ -89,12 +93,212 @@ var _ = Describe("sopssecret controller", func() {
 				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
 			}, maxTimeout).Should(HaveOccurred())
 		})
+
+		It("reports the decrypt failure in status", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: value"
+			mockedDecrytor.DecryptFunc = func(input []byte, format string) ([]byte, error) {
+				return nil, fmt.Errorf("no key could decrypt the data")
+			}
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() metav1.ConditionStatus {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionDecrypted)
+			}, maxTimeout).Should(Equal(metav1.ConditionFalse))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeWarning)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonDecryptFailed))
+
+			ready := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionReady)
+			Expect(ready).ToNot(BeNil())
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(sopssecretsv1.ReasonDecryptFailed))
+			Expect(ready.Message).To(ContainSubstring("no key could decrypt the data"))
+			Expect(fetchSopsSecret.Status.Targets).To(HaveLen(1))
+			Expect(fetchSopsSecret.Status.Targets[0].Synced).To(BeFalse())
+		})
+
+		It("never falls back on the controller keys without the decryption key secret", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: value"
+			newSecret.Spec.DecryptionKeyRef = &sopssecretsv1.SopsSecretKeyReference{Name: "missing-keys"}
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				condition := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionDecrypted)
+				if condition == nil {
+					return ""
+				}
+				return condition.Reason
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonKeyUnavailable))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeWarning)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonKeyUnavailable))
+			Expect(mockedDecrytor.DecryptCalls()).To(BeEmpty())
+		})
+
+		It("refuses data encrypted to master keys the namespace doesn't allow", func() {
+			namespace := &corev1.Namespace{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: currentNamespace}, namespace)).To(Succeed())
+			namespace.Annotations = map[string]string{sopssecretsv1.AllowedRecipientsAnnotation: "age1allowed"}
+			Expect(k8sClient.Update(ctx, namespace)).To(Succeed())
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: ENC[AES256_GCM,data:x,iv:x,tag:x,type:str]\nsops:\n  age:\n  - recipient: age1other\n    enc: x\n  lastmodified: \"2021-01-01T00:00:00Z\"\n  mac: x\n"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				condition := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionDecrypted)
+				if condition == nil {
+					return ""
+				}
+				return condition.Reason
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonRecipientDenied))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeWarning)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonRecipientDenied))
+			Expect(mockedDecrytor.DecryptCalls()).To(BeEmpty())
+		})
+
+		It("re-checks the recipients of a SopsSecret already in sync", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: ENC[AES256_GCM,data:x,iv:x,tag:x,type:str]\nsops:\n  age:\n  - recipient: age1other\n    enc: x\n  lastmodified: \"2021-01-01T00:00:00Z\"\n  mac: x\n"
+			mockedDecrytor.DecryptFunc = func(input []byte, format string) ([]byte, error) {
+				return []byte("secret: value"), nil
+			}
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() metav1.ConditionStatus {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionReady)
+			}, maxTimeout).Should(Equal(metav1.ConditionTrue))
+
+			namespace := &corev1.Namespace{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: currentNamespace}, namespace)).To(Succeed())
+			namespace.Annotations = map[string]string{sopssecretsv1.AllowedRecipientsAnnotation: "age1allowed"}
+			Expect(k8sClient.Update(ctx, namespace)).To(Succeed())
+
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionReason(fetchSopsSecret, sopssecretsv1.ConditionReady)
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonRecipientDenied))
+			Expect(getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionDecrypted)).To(Equal(metav1.ConditionFalse))
+			Expect(mockedDecrytor.DecryptCalls()).To(HaveLen(1))
+		})
+
+		It("refuses a SopsSecret without decryption key secret when the namespace requires one", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: value"
+			mockedDecrytor.DecryptFunc = func(input []byte, format string) ([]byte, error) {
+				return []byte("secret: value"), nil
+			}
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() metav1.ConditionStatus {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionReady)
+			}, maxTimeout).Should(Equal(metav1.ConditionTrue))
+
+			namespace := &corev1.Namespace{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: currentNamespace}, namespace)).To(Succeed())
+			namespace.Annotations = map[string]string{sopssecretsv1.RequireDecryptionKeyRefAnnotation: "true"}
+			Expect(k8sClient.Update(ctx, namespace)).To(Succeed())
+
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionReason(fetchSopsSecret, sopssecretsv1.ConditionDecrypted)
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonKeyUnavailable))
+			Expect(getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionReady)).To(Equal(metav1.ConditionFalse))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeWarning)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonKeyUnavailable))
+			Expect(mockedDecrytor.DecryptCalls()).To(HaveLen(1))
+		})
+
+		It("refuses values that aren't encrypted without allowUnencrypted", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.AllowUnencrypted = false
+			newSecret.Spec.EncryptedData = "secret: value"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				condition := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionDecrypted)
+				if condition == nil {
+					return ""
+				}
+				return condition.Reason
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonUnencrypted))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeWarning)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonUnencrypted))
+			Expect(mockedDecrytor.DecryptCalls()).To(BeEmpty())
+
+			createdSecret := &corev1.Secret{}
+			Consistently(func() error {
+				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+			}, maxTimeout).Should(HaveOccurred())
+		})
+
+		It("refuses a SopsSecret in sync once allowUnencrypted is turned off", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: value"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() metav1.ConditionStatus {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionReady)
+			}, maxTimeout).Should(Equal(metav1.ConditionTrue))
+
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret); err != nil {
+					return err
+				}
+				fetchSopsSecret.Spec.AllowUnencrypted = false
+				return k8sClient.Update(ctx, fetchSopsSecret)
+			}, maxTimeout).Should(Succeed())
+
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionReason(fetchSopsSecret, sopssecretsv1.ConditionReady)
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonUnencrypted))
+			Expect(getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionSynced)).To(Equal(metav1.ConditionFalse))
+		})
 	})
 
 	Context("decrypts secrets successfuly", func() {
 		It("decrypts a simple secret", func() {
 			newSecret := getTestSopsSecret()
-			newSecret.Data = "test: value"
+			newSecret.Spec.EncryptedData = "test: value"
 
 			err := k8sClient.Create(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
@@ -109,6 +313,194 @@ var _ = Describe("sopssecret controller", func() {
 			}, maxTimeout).Should(Not(HaveOccurred()))
 
 			Expect(createdSecret.Data["test"]).To(Equal([]byte("value")))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeNormal)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonCreated))
+		})
+
+		It("decodes binary values", func() {
+			binaryValue := []byte{0x1f, 0x8b, 0x08, 0x00, 0xff, 0xfe}
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = fmt.Sprintf("keystore: %s\ntext: value", secretdata.EncodeValue(binaryValue))
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			Expect(createdSecret.Data["keystore"]).To(Equal(binaryValue))
+			Expect(createdSecret.Data["text"]).To(Equal([]byte("value")))
+		})
+
+		It("rejects binary values that aren't base64", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "keystore: " + secretdata.BinaryPrefix + "not-base64!"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				condition := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionDecrypted)
+				if condition == nil {
+					return ""
+				}
+				return condition.Reason
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonInvalidPayload))
+		})
+
+		It("stores nested values with the value encoding", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "port: 5432\nconfig:\n  replicas: 2\n  hosts: [a, b]"
+			newSecret.Spec.ValueEncoding = "flatten"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			Expect(createdSecret.Data).To(Equal(map[string][]byte{
+				"port":            []byte("5432"),
+				"config.replicas": []byte("2"),
+				"config.hosts.0":  []byte("a"),
+				"config.hosts.1":  []byte("b"),
+			}))
+		})
+
+		It("rejects nested values without a value encoding", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "config:\n  replicas: 2"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				condition := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionDecrypted)
+				if condition == nil {
+					return ""
+				}
+				return condition.Message
+			}, maxTimeout).Should(ContainSubstring("spec.valueEncoding"))
+		})
+
+		It("decrypts dotenv payloads", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "DATABASE_URL=postgres://db\nMULTILINE=a\\nb\n"
+			newSecret.Spec.Format = "dotenv"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			Expect(createdSecret.Data).To(Equal(map[string][]byte{
+				"DATABASE_URL": []byte("postgres://db"),
+				"MULTILINE":    []byte("a\nb"),
+			}))
+			Expect(mockedDecrytor.DecryptCalls()[0].S).To(Equal("dotenv"))
+		})
+
+		It("stores binary payloads under the binary key", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "whole: file\n"
+			newSecret.Spec.Format = "binary"
+			newSecret.Spec.BinaryKey = "config.yaml"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			Expect(createdSecret.Data).To(Equal(map[string][]byte{
+				"config.yaml": []byte("whole: file\n"),
+			}))
+		})
+
+		It("renders template data", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "user: admin\npassword: s3cret"
+			newSecret.Spec.Template.Data = map[string]string{
+				"url": "postgres://{{ .user }}:{{ .password }}@db/app",
+			}
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			Expect(createdSecret.Data).To(Equal(map[string][]byte{
+				"user":     []byte("admin"),
+				"password": []byte("s3cret"),
+				"url":      []byte("postgres://admin:s3cret@db/app"),
+			}))
+		})
+
+		It("reports template errors", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "password: s3cret"
+			newSecret.Spec.Template.Data = map[string]string{
+				"url": "postgres://{{ .user }}@db/app",
+			}
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				condition := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionDecrypted)
+				if condition == nil {
+					return ""
+				}
+				return condition.Reason
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonTemplateFailed))
+
+			condition := meta.FindStatusCondition(fetchSopsSecret.Status.Conditions, sopssecretsv1.ConditionDecrypted)
+			Expect(condition.Message).To(ContainSubstring(`template "url"`))
+			Expect(condition.Message).ToNot(ContainSubstring("s3cret"))
+		})
+
+		It("reports ready status", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "test: value"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() metav1.ConditionStatus {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionReady)
+			}, maxTimeout).Should(Equal(metav1.ConditionTrue))
+
+			Expect(getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionDecrypted)).To(Equal(metav1.ConditionTrue))
+			Expect(getConditionStatus(fetchSopsSecret, sopssecretsv1.ConditionSynced)).To(Equal(metav1.ConditionTrue))
+			Expect(fetchSopsSecret.Status.ObservedGeneration).To(Equal(fetchSopsSecret.Generation))
+			Expect(fetchSopsSecret.Status.LastSyncTime).ToNot(BeNil())
+			Expect(fetchSopsSecret.Status.Targets).To(ConsistOf(sopssecretsv1.SopsSecretTargetStatus{
+				Name:      currentObjectName,
+				Namespace: currentNamespace,
+				Synced:    true,
+			}))
 		})
 	})
 
@@ -116,7 +508,7 @@ var _ = Describe("sopssecret controller", func() {
 		It("Reconcile short-circuits on match", func() {
 			newSecret := getTestSopsSecret()
 			newSecretKey := types.NamespacedName{Name: newSecret.Name, Namespace: newSecret.Namespace}
-			newSecret.Data = "annotation: test"
+			newSecret.Spec.EncryptedData = "annotation: test"
 
 			err := k8sClient.Create(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
@@ -147,7 +539,7 @@ var _ = Describe("sopssecret controller", func() {
 		It("updates the secret when sopssecret is updated", func() {
 			newSecret := getTestSopsSecret()
 			newSecretKey := types.NamespacedName{Name: newSecret.Name, Namespace: newSecret.Namespace}
-			newSecret.Data = "secret: update"
+			newSecret.Spec.EncryptedData = "secret: update"
 
 			err := k8sClient.Create(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
@@ -161,7 +553,7 @@ var _ = Describe("sopssecret controller", func() {
 			Expect(createdSecret.Data["secret"]).To(Equal([]byte("update")))
 
 			_ = k8sClient.Get(ctx, newSecretKey, newSecret)
-			newSecret.Data = "secret: test"
+			newSecret.Spec.EncryptedData = "secret: test"
 			err = k8sClient.Update(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -176,9 +568,54 @@ var _ = Describe("sopssecret controller", func() {
 			}, maxTimeout).Should(Equal(2))
 		})
 
+		It("prunes the old secret when the template name changes", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: value"
+			Expect(k8sClient.Create(ctx, newSecret)).To(Succeed())
+
+			oldSecretKey := getNamespacedName()
+			Eventually(func() error {
+				return k8sClient.Get(ctx, oldSecretKey, &corev1.Secret{})
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			renamedSecretKey := types.NamespacedName{Name: getRandomString(), Namespace: currentNamespace}
+			Eventually(func() error {
+				if err := k8sClient.Get(ctx, getNamespacedName(), newSecret); err != nil {
+					return err
+				}
+				newSecret.Spec.Template.Name = renamedSecretKey.Name
+				return k8sClient.Update(ctx, newSecret)
+			}, maxTimeout).Should(Succeed())
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, renamedSecretKey, &corev1.Secret{})
+			}, maxTimeout).Should(Not(HaveOccurred()))
+			Eventually(func() bool {
+				return k8serrors.IsNotFound(k8sClient.Get(ctx, oldSecretKey, &corev1.Secret{}))
+			}, maxTimeout).Should(BeTrue())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() []sopssecretsv1.SopsSecretTargetReference {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return fetchSopsSecret.Status.PrunedTargets
+			}, maxTimeout).Should(ConsistOf(sopssecretsv1.SopsSecretTargetReference{
+				Namespace: oldSecretKey.Namespace,
+				Name:      oldSecretKey.Name,
+			}))
+			Expect(fetchSopsSecret.Status.Targets).To(ConsistOf(sopssecretsv1.SopsSecretTargetStatus{
+				Namespace: renamedSecretKey.Namespace,
+				Name:      renamedSecretKey.Name,
+				Synced:    true,
+			}))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeNormal)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonPruned))
+		})
+
 		It("restores the secret when it is updated", func() {
 			newSecret := getTestSopsSecret()
-			newSecret.Data = "secret: update"
+			newSecret.Spec.EncryptedData = "secret: update"
 
 			err := k8sClient.Create(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
@@ -213,11 +650,77 @@ var _ = Describe("sopssecret controller", func() {
 				Expect(err).ToNot(HaveOccurred())
 				return createdSecret.Data["secret"]
 			}, maxTimeout).Should(Equal([]byte("sadfasdf")))
+
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeWarning)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonDriftCorrected))
+		})
+
+		It("restores the secret of a sopssecret with dots in its name", func() {
+			currentObjectName = fmt.Sprintf("app.config.%s", getRandomString())
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: dotted"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecretKey := getNamespacedName()
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			Expect(createdSecret.Annotations[controllers.OwnerNameAnnotation]).To(Equal(currentObjectName))
+			Expect(createdSecret.Annotations[controllers.OwnerNamespaceAnnotation]).To(Equal(currentNamespace))
+
+			createdSecret.Data["secret"] = []byte("drifted")
+			err = k8sClient.Update(ctx, createdSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(func() []byte {
+				err = k8sClient.Get(ctx, createdSecretKey, createdSecret)
+				Expect(err).ToNot(HaveOccurred())
+				return createdSecret.Data["secret"]
+			}, maxTimeout).Should(Equal([]byte("dotted")))
+		})
+
+		It("migrates secrets using the legacy ownership label", func() {
+			legacySecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      currentObjectName,
+					Namespace: currentNamespace,
+					Labels: map[string]string{
+						controllers.OwnershipLabel: fmt.Sprintf("%s.%s", currentObjectName, currentNamespace),
+					},
+				},
+				Data: map[string][]byte{
+					"secret": []byte("legacy"),
+				},
+			}
+			err := k8sClient.Create(ctx, legacySecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: migrated"
+
+			err = k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecret := &corev1.Secret{}
+			Eventually(func() []byte {
+				err = k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+				Expect(err).ToNot(HaveOccurred())
+				return createdSecret.Data["secret"]
+			}, maxTimeout).Should(Equal([]byte("migrated")))
+
+			Expect(createdSecret.Labels[controllers.OwnershipLabel]).ToNot(Equal(legacySecret.Labels[controllers.OwnershipLabel]))
+			Expect(createdSecret.Annotations[controllers.OwnerNameAnnotation]).To(Equal(currentObjectName))
+			Expect(createdSecret.Annotations[controllers.OwnerNamespaceAnnotation]).To(Equal(currentNamespace))
 		})
 
 		It("does not overwrite ignored keys", func() {
 			newSecret := getTestSopsSecret()
-			newSecret.Data = "secret: update"
+			newSecret.Spec.EncryptedData = "secret: update"
 			newSecret.Spec.IgnoredKeys = []string{
 				"notupdated",
 				"notremoved",
@@ -250,7 +753,7 @@ var _ = Describe("sopssecret controller", func() {
 
 		It("annotations and labels behaviors", func() {
 			newSecret := getTestSopsSecret()
-			newSecret.Data = "secret: update"
+			newSecret.Spec.EncryptedData = "secret: update"
 
 			newSecret.Spec.Template.Annotations = map[string]string{
 				"test.annotation":   "value",
@@ -280,7 +783,7 @@ var _ = Describe("sopssecret controller", func() {
 
 		It("secret is deleted when sopssecret is deleted", func() {
 			newSecret := getTestSopsSecret()
-			newSecret.Data = "secret: update"
+			newSecret.Spec.EncryptedData = "secret: update"
 
 			err := k8sClient.Create(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
@@ -301,7 +804,7 @@ var _ = Describe("sopssecret controller", func() {
 
 		It("secret is not deleted when skipFinalizer spec is set", func() {
 			newSecret := getTestSopsSecret()
-			newSecret.Data = "secret: update"
+			newSecret.Spec.EncryptedData = "secret: update"
 			newSecret.Spec.SkipFinalizers = true
 
 			err := k8sClient.Create(ctx, newSecret)
@@ -321,13 +824,100 @@ var _ = Describe("sopssecret controller", func() {
 			}, maxTimeout).ShouldNot(HaveOccurred())
 		})
 
+		It("secret is not deleted when the deletion policy is Retain", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: update"
+			newSecret.Spec.DeletionPolicy = sopssecretsv1.DeletionPolicyRetain
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecretKey := getNamespacedName()
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Expect(k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)).To(Succeed())
+			Expect(fetchSopsSecret.Finalizers).ToNot(ContainElement(controllers.DeletionFinalizer))
+
+			err = k8sClient.Delete(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).ShouldNot(HaveOccurred())
+		})
+
+		It("retaining the secrets of one sopssecret does not affect the others", func() {
+			retained := getTestSopsSecret()
+			retained.Name = getRandomString()
+			retained.Spec.EncryptedData = "secret: retained"
+			retained.Spec.DeletionPolicy = sopssecretsv1.DeletionPolicyRetain
+			Expect(k8sClient.Create(ctx, retained)).To(Succeed())
+
+			retainedSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(retained), retainedSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: deleted"
+			Expect(k8sClient.Create(ctx, newSecret)).To(Succeed())
+
+			createdSecretKey := getNamespacedName()
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() []string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return fetchSopsSecret.Finalizers
+			}, maxTimeout).Should(ContainElement(controllers.DeletionFinalizer))
+
+			Expect(k8sClient.Delete(ctx, newSecret)).To(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(HaveOccurred())
+
+			Expect(k8sClient.Delete(ctx, retained)).To(Succeed())
+		})
+
+		It("the deletion policy takes precedence over skipFinalizers", func() {
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.EncryptedData = "secret: update"
+			newSecret.Spec.SkipFinalizers = true
+			newSecret.Spec.DeletionPolicy = sopssecretsv1.DeletionPolicyDelete
+			Expect(k8sClient.Create(ctx, newSecret)).To(Succeed())
+
+			createdSecretKey := getNamespacedName()
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() []string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return fetchSopsSecret.Finalizers
+			}, maxTimeout).Should(ContainElement(controllers.DeletionFinalizer))
+
+			Expect(k8sClient.Delete(ctx, newSecret)).To(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(HaveOccurred())
+		})
+
 		It("Cross namespace reconcile", func() {
 			newSecret := getTestSopsSecret()
 			newSecret.Spec.Template.Namespaces = []string{
 				"cross-namespace",
 				"cross-namespace1",
 			}
-			newSecret.Data = "secret: exists"
+			newSecret.Spec.EncryptedData = "secret: exists"
 
 			newNamespace := &corev1.Namespace{
 				ObjectMeta: metav1.ObjectMeta{
@@ -365,13 +955,278 @@ var _ = Describe("sopssecret controller", func() {
 			Expect(createdSecret.Data["secret"]).To(Equal([]byte("exists")))
 		})
 
+		It("deletes the secrets in every target namespace", func() {
+			targetNamespaces := []string{getRandomString(), getRandomString(), getRandomString()}
+			for _, namespace := range targetNamespaces {
+				createNamespace(namespace)
+			}
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.Template.Namespaces = targetNamespaces
+			newSecret.Spec.EncryptedData = "secret: exists"
+			Expect(k8sClient.Create(ctx, newSecret)).To(Succeed())
+
+			for _, namespace := range targetNamespaces {
+				createdSecretKey := types.NamespacedName{Name: currentObjectName, Namespace: namespace}
+				Eventually(func() error {
+					return k8sClient.Get(ctx, createdSecretKey, &corev1.Secret{})
+				}, maxTimeout).Should(Not(HaveOccurred()))
+			}
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() []string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return fetchSopsSecret.Finalizers
+			}, maxTimeout).Should(ContainElement(controllers.DeletionFinalizer))
+
+			Expect(k8sClient.Delete(ctx, newSecret)).To(Succeed())
+
+			for _, namespace := range targetNamespaces {
+				createdSecretKey := types.NamespacedName{Name: currentObjectName, Namespace: namespace}
+				Eventually(func() bool {
+					err := k8sClient.Get(ctx, createdSecretKey, &corev1.Secret{})
+					return k8serrors.IsNotFound(err)
+				}, maxTimeout).Should(BeTrue(), "secret in namespace %s was not deleted", namespace)
+			}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, getNamespacedName(), &sopssecretsv1.SopsSecret{})
+				return k8serrors.IsNotFound(err)
+			}, maxTimeout).Should(BeTrue())
+		})
+
+		It("deletes every owned target but leaves unowned secrets alone", func() {
+			ownedNamespace, unownedNamespace := getRandomString(), getRandomString()
+			createNamespace(ownedNamespace)
+			createNamespace(unownedNamespace)
+
+			unownedSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: currentObjectName, Namespace: unownedNamespace},
+				StringData: map[string]string{"secret": "unowned"},
+			}
+			Expect(k8sClient.Create(ctx, unownedSecret)).To(Succeed())
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.Template.Namespaces = []string{unownedNamespace, ownedNamespace}
+			newSecret.Spec.EncryptedData = "secret: exists"
+			Expect(k8sClient.Create(ctx, newSecret)).To(Succeed())
+
+			ownedSecretKey := types.NamespacedName{Name: currentObjectName, Namespace: ownedNamespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, ownedSecretKey, &corev1.Secret{})
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() []string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return fetchSopsSecret.Finalizers
+			}, maxTimeout).Should(ContainElement(controllers.DeletionFinalizer))
+
+			Expect(k8sClient.Delete(ctx, newSecret)).To(Succeed())
+
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, getNamespacedName(), &sopssecretsv1.SopsSecret{})
+				return k8serrors.IsNotFound(err)
+			}, maxTimeout).Should(BeTrue())
+			Expect(k8serrors.IsNotFound(k8sClient.Get(ctx, ownedSecretKey, &corev1.Secret{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(unownedSecret), &corev1.Secret{})).To(Succeed())
+		})
+
+		It("leaves the secrets of another sopssecret alone", func() {
+			otherSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      getRandomString(),
+					Namespace: currentNamespace,
+					Labels: map[string]string{
+						controllers.OwnershipLabel: fmt.Sprintf("%s.%s", "other", currentNamespace),
+					},
+				},
+				StringData: map[string]string{"secret": "other"},
+			}
+			Expect(k8sClient.Create(ctx, otherSecret)).To(Succeed())
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.Template.Name = otherSecret.Name
+			newSecret.Spec.EncryptedData = "secret: takeover"
+			Expect(k8sClient.Create(ctx, newSecret)).To(Succeed())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() []sopssecretsv1.SopsSecretTargetStatus {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return fetchSopsSecret.Status.Targets
+			}, maxTimeout).Should(HaveLen(1))
+			Expect(fetchSopsSecret.Status.Targets[0].Synced).To(BeFalse())
+			Expect(fetchSopsSecret.Finalizers).To(ContainElement(controllers.DeletionFinalizer))
+
+			Expect(k8sClient.Delete(ctx, newSecret)).To(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, getNamespacedName(), &sopssecretsv1.SopsSecret{})
+				return k8serrors.IsNotFound(err)
+			}, maxTimeout).Should(BeTrue())
+
+			fetchOtherSecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(otherSecret), fetchOtherSecret)).To(Succeed())
+			Expect(fetchOtherSecret.Data["secret"]).To(Equal([]byte("other")))
+		})
+
+		It("neither writes nor deletes the targets the policy denies", func() {
+			deniedNamespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   getRandomString(),
+					Labels: map[string]string{deniedNamespaceLabel: "true"},
+				},
+			}
+			Expect(k8sClient.Create(ctx, deniedNamespace)).To(Succeed())
+			allowedNamespace := getRandomString()
+			createNamespace(allowedNamespace)
+
+			// Looks like it was written by the SopsSecret, e.g. before the policy was enforced
+			deniedSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      currentObjectName,
+					Namespace: deniedNamespace.Name,
+					Labels: map[string]string{
+						controllers.OwnershipLabel: fmt.Sprintf("%s.%s", currentObjectName, currentNamespace),
+					},
+				},
+				StringData: map[string]string{"secret": "existing"},
+			}
+			Expect(k8sClient.Create(ctx, deniedSecret)).To(Succeed())
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.Template.Namespaces = []string{deniedNamespace.Name, allowedNamespace}
+			newSecret.Spec.EncryptedData = "secret: value"
+			Expect(k8sClient.Create(ctx, newSecret)).To(Succeed())
+
+			fetchSopsSecret := &sopssecretsv1.SopsSecret{}
+			Eventually(func() string {
+				_ = k8sClient.Get(ctx, getNamespacedName(), fetchSopsSecret)
+				return getConditionReason(fetchSopsSecret, sopssecretsv1.ConditionSynced)
+			}, maxTimeout).Should(Equal(sopssecretsv1.ReasonTargetDenied))
+			Expect(fetchSopsSecret.Status.Targets).To(ContainElement(sopssecretsv1.SopsSecretTargetStatus{
+				Namespace: deniedNamespace.Name,
+				Name:      currentObjectName,
+				Denied:    true,
+				Message:   "denied by the target policy",
+			}))
+			Eventually(func() []string {
+				return getEventReasons(corev1.EventTypeWarning)
+			}, maxTimeout).Should(ContainElement(controllers.EventReasonTargetDenied))
+
+			allowedSecretKey := types.NamespacedName{Name: currentObjectName, Namespace: allowedNamespace}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, allowedSecretKey, &corev1.Secret{})
+			}, maxTimeout).Should(Succeed())
+
+			fetchDeniedSecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deniedSecret), fetchDeniedSecret)).To(Succeed())
+			Expect(fetchDeniedSecret.Data["secret"]).To(Equal([]byte("existing")))
+
+			Expect(k8sClient.Delete(ctx, newSecret)).To(Succeed())
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, getNamespacedName(), &sopssecretsv1.SopsSecret{})
+				return k8serrors.IsNotFound(err)
+			}, maxTimeout).Should(BeTrue())
+			Expect(k8serrors.IsNotFound(k8sClient.Get(ctx, allowedSecretKey, &corev1.Secret{}))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deniedSecret), &corev1.Secret{})).To(Succeed())
+		})
+
+		It("decrypts once for every target namespace", func() {
+			targetNamespaces := []string{getRandomString(), getRandomString(), getRandomString()}
+			for _, targetNamespace := range targetNamespaces {
+				createNamespace(targetNamespace)
+			}
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.Template.Namespaces = targetNamespaces
+			newSecret.Spec.EncryptedData = "secret: fanout"
+
+			err := k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecretKey := getNamespacedName()
+			createdSecret := &corev1.Secret{}
+			for _, targetNamespace := range targetNamespaces {
+				createdSecretKey.Namespace = targetNamespace
+				Eventually(func() error {
+					return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+				}, maxTimeout).Should(Not(HaveOccurred()))
+				Expect(createdSecret.Data["secret"]).To(Equal([]byte("fanout")))
+			}
+
+			Consistently(func() int {
+				return len(mockedDecrytor.DecryptCalls())
+			}, maxTimeout).Should(Equal(1))
+		})
+
+		It("Namespace selector reconcile and garbage collection", func() {
+			tenant := getRandomString()
+			targetNamespace := &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: getRandomString(),
+					Labels: map[string]string{
+						"tenant": tenant,
+					},
+				},
+			}
+			err := k8sClient.Create(ctx, targetNamespace)
+			Expect(err).ToNot(HaveOccurred())
+
+			newSecret := getTestSopsSecret()
+			newSecret.Spec.Template.NamespaceSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"tenant": tenant,
+				},
+			}
+			newSecret.Spec.EncryptedData = "secret: selected"
+
+			err = k8sClient.Create(ctx, newSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdSecretKey := getNamespacedName()
+			createdSecretKey.Namespace = targetNamespace.Name
+			createdSecret := &corev1.Secret{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+			Expect(createdSecret.Data["secret"]).To(Equal([]byte("selected")))
+
+			// A namespace appearing later is picked up
+			lateNamespace := targetNamespace.DeepCopy()
+			lateNamespace.ObjectMeta = metav1.ObjectMeta{
+				Name:   getRandomString(),
+				Labels: targetNamespace.Labels,
+			}
+			err = k8sClient.Create(ctx, lateNamespace)
+			Expect(err).ToNot(HaveOccurred())
+
+			lateSecretKey := getNamespacedName()
+			lateSecretKey.Namespace = lateNamespace.Name
+			Eventually(func() error {
+				return k8sClient.Get(ctx, lateSecretKey, createdSecret)
+			}, maxTimeout).Should(Not(HaveOccurred()))
+
+			// A namespace that stops matching is pruned
+			_ = k8sClient.Get(ctx, types.NamespacedName{Name: targetNamespace.Name}, targetNamespace)
+			targetNamespace.Labels = nil
+			err = k8sClient.Update(ctx, targetNamespace)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(func() error {
+				return k8sClient.Get(ctx, createdSecretKey, createdSecret)
+			}, maxTimeout).Should(HaveOccurred())
+
+			// The SopsSecret namespace itself is not targeted when only a selector is set
+			Consistently(func() error {
+				return k8sClient.Get(ctx, getNamespacedName(), createdSecret)
+			}, maxTimeout).Should(HaveOccurred())
+		})
+
 		It("Cross namespace garbage collection", func() {
 			newSecret := getTestSopsSecret()
 			newSecret.Spec.Template.Namespaces = []string{
 				"cross-namespace",
 				"cross-namespace1",
 			}
-			newSecret.Data = "secret: exists"
+			newSecret.Spec.EncryptedData = "secret: exists"
 
 			err := k8sClient.Create(ctx, newSecret)
 			Expect(err).ToNot(HaveOccurred())
@@ -404,8 +1259,8 @@ var _ = Describe("sopssecret controller", func() {
 	})
 })
 
-func getTestSopsSecret() *sopssecretsv1beta1.SopsSecret {
-	return &sopssecretsv1beta1.SopsSecret{
+func getTestSopsSecret() *sopssecretsv1.SopsSecret {
+	return &sopssecretsv1.SopsSecret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      currentObjectName,
 			Namespace: currentNamespace,
@@ -413,7 +1268,39 @@ func getTestSopsSecret() *sopssecretsv1beta1.SopsSecret {
 				"secrets.dhouti.dev/owned-by-controller": fmt.Sprintf("%s.%s", currentObjectName, currentNamespace),
 			},
 		},
+		// The mocked decryptor is fed plaintext
+		Spec: sopssecretsv1.SopsSecretSpec{AllowUnencrypted: true},
+	}
+}
+
+func getConditionStatus(obj *sopssecretsv1.SopsSecret, conditionType string) metav1.ConditionStatus {
+	condition := meta.FindStatusCondition(obj.Status.Conditions, conditionType)
+	if condition == nil {
+		return metav1.ConditionUnknown
+	}
+	return condition.Status
+}
+
+func getConditionReason(obj *sopssecretsv1.SopsSecret, conditionType string) string {
+	condition := meta.FindStatusCondition(obj.Status.Conditions, conditionType)
+	if condition == nil {
+		return ""
+	}
+	return condition.Reason
+}
+
+func getEventReasons(eventType string) []string {
+	eventList := &corev1.EventList{}
+	err := k8sClient.List(context.Background(), eventList, client.InNamespace(currentNamespace))
+	Expect(err).ToNot(HaveOccurred())
+
+	var reasons []string
+	for _, event := range eventList.Items {
+		if event.InvolvedObject.Name == currentObjectName && event.Type == eventType {
+			reasons = append(reasons, event.Reason)
+		}
 	}
+	return reasons
 }
 
 func getNamespacedName() types.NamespacedName {
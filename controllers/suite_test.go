@@ -17,13 +17,16 @@ limitations under the License.
 package controllers_test
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/dhouti/sops-converter/controllers"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -33,7 +36,7 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
-	secretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -45,6 +48,10 @@ var k8sClient client.Client
 var testEnv *envtest.Environment
 var usedReconciler *controllers.SopsSecretReconciler
 
+// deniedNamespaceLabel marks the namespaces no SopsSecret of another namespace may write to,
+// the target policy of the suite allows every other namespace.
+const deniedNamespaceLabel = "secrets.dhouti.dev/test-denied"
+
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
@@ -66,7 +73,7 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).ToNot(HaveOccurred())
 	Expect(cfg).ToNot(BeNil())
 
-	err = secretsv1beta1.AddToScheme(scheme.Scheme)
+	err = secretsv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
 	// +kubebuilder:scaffold:scheme
@@ -77,9 +84,17 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).ToNot(HaveOccurred())
 
 	usedReconciler = &controllers.SopsSecretReconciler{
-		Client: k8sManager.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SopsSecret"),
-		Scheme: scheme.Scheme,
+		Client:   k8sManager.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("SopsSecret"),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("sops-converter"),
+
+		DecryptCacheSize: 16,
+		DecryptCacheTTL:  time.Minute,
+
+		MaxConcurrentReconciles: 4,
+
+		EnforceTargetPolicy: true,
 	}
 	err = usedReconciler.SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
@@ -92,6 +107,20 @@ var _ = BeforeSuite(func(done Done) {
 
 	k8sClient = k8sManager.GetClient()
 	Expect(k8sClient).ToNot(BeNil())
+
+	err = k8sClient.Create(context.Background(), &secretsv1.SopsSecretPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-undenied"},
+		Spec: secretsv1.SopsSecretPolicySpec{
+			SourceNamespaces: []string{"*"},
+			Targets: []secretsv1.SopsSecretPolicyTarget{{
+				NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      deniedNamespaceLabel,
+					Operator: metav1.LabelSelectorOpDoesNotExist,
+				}}},
+			}},
+		},
+	})
+	Expect(err).ToNot(HaveOccurred())
 	close(done)
 }, 60)
 
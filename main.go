@@ -17,48 +17,86 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/bombsimon/logrusr/v2"
+	secretsv1 "github.com/dhouti/sops-converter/api/v1"
 	secretsv1beta1 "github.com/dhouti/sops-converter/api/v1beta1"
 	"github.com/dhouti/sops-converter/controllers"
-	"github.com/dhouti/sops-converter/pkg/exec"
+	"github.com/dhouti/sops-converter/pkg/decrypt"
 	"github.com/dhouti/sops-converter/pkg/k8s"
+	"github.com/dhouti/sops-converter/pkg/keyring"
 	"github.com/dhouti/sops-converter/pkg/logger"
 	"github.com/dhouti/sops-converter/pkg/version"
+	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/workqueue"
+	"net/http"
 	"os"
 	goruntime "runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"strconv"
+	"strings"
 
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"time"
 	// +kubebuilder:scaffold:imports
 )
 
-// watchNamespaceEnvVar is the constant for env variable WATCH_NAMESPACE
-// which specifies the namespaces (comma-separated) to watch.
-// An empty value means the operator is running with cluster scope.
-const (
-	cleanGpgTmp   = "find /tmp -name \"tmp.*\" -type f -mmin +30 -exec rm {} \\;" // 30 minutes
-	refreshGpgFmt = "echo %s | gpg --batch --always-trust --yes --passphrase-fd 0 --pinentry-mode=loopback -s $(mktemp)"
-)
-
 var (
 	scheme      = runtime.NewScheme()
 	metricsAddr = ":8080"
-	done        = make(chan bool)
+	decryptor   = decrypt.BackendExec
+	cacheSize   = 256
+	cacheTTL    = 10 * time.Minute
+	webhooks    = true
+	webhookPort = 9443
 	log         = logrusr.New(
 		logger.GenerateLogger(),
 		logrusr.WithReportCaller(),
 	).WithCallDepth(0)
+
+	leaderElection          = false
+	leaderElectionNamespace = ""
+	leaderElectionID        = "sops-converter.secrets.dhouti.dev"
+	leaseDuration           = 15 * time.Second
+	renewDeadline           = 10 * time.Second
+	retryPeriod             = 2 * time.Second
+
+	maxConcurrentReconciles = 4
+	rateLimiterBaseDelay    = 5 * time.Millisecond
+	rateLimiterMaxDelay     = 1000 * time.Second
+	rateLimiterQPS          = 10.0
+	rateLimiterBurst        = 100
+
+	probeAddr              = ":8081"
+	canaryFile             = ""
+	canaryFormat           = decrypt.FormatYAML
+	decryptorCheckInterval = time.Minute
+	decryptorReadiness     = true
+	wedgedTimeout          = 10 * time.Minute
+
+	gpgKeyFiles        = ""
+	gpgOwnertrustFile  = ""
+	gpgRefreshInterval = 9 * time.Minute
+
+	ageKeysDir            = ""
+	ageKeysSecret         = ""
+	ageKeysReloadInterval = 30 * time.Second
+
+	enforceTargetPolicy = false
 )
 
 func init() {
 	logger.ConfigControllerLog()
 	_ = clientgoscheme.AddToScheme(scheme)
 	_ = secretsv1beta1.AddToScheme(scheme)
+	_ = secretsv1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -72,11 +110,64 @@ func printVersion() {
 
 func main() {
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&decryptor, "decryptor", decrypt.BackendExec,
+		"The decryption backend, \"exec\" runs the sops binary, \"native\" decrypts in-process with the sops libraries.")
+	flag.IntVar(&cacheSize, "decrypt-cache-size", cacheSize,
+		"The number of decrypted payloads kept in memory, 0 disables the cache.")
+	flag.DurationVar(&cacheTTL, "decrypt-cache-ttl", cacheTTL, "How long a decrypted payload is kept in memory.")
+	flag.BoolVar(&webhooks, "enable-webhooks", webhooks, "Serve the SopsSecret conversion and validating admission webhooks, required to serve v1beta1 objects.")
+	flag.IntVar(&webhookPort, "webhook-port", webhookPort, "The port the webhook server binds to.")
+	flag.BoolVar(&leaderElection, "leader-elect", leaderElection,
+		"Elect a leader among the replicas so a single one reconciles, required to run more than one replica.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", leaderElectionNamespace,
+		"The namespace holding the leader election lease, defaults to the namespace the controller runs in.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", leaderElectionID, "The name of the leader election lease.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", leaseDuration,
+		"How long replicas wait before taking over the lease of a leader that stopped renewing it.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", renewDeadline,
+		"How long the leader retries renewing the lease before giving up leadership.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", retryPeriod,
+		"How long replicas wait between attempts to acquire or renew the lease.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", maxConcurrentReconciles,
+		"The number of SopsSecrets reconciled in parallel, so a slow decrypt doesn't hold up the others.")
+	flag.DurationVar(&rateLimiterBaseDelay, "rate-limiter-base-delay", rateLimiterBaseDelay,
+		"The delay before the first retry of a failed SopsSecret, doubled on every following failure.")
+	flag.DurationVar(&rateLimiterMaxDelay, "rate-limiter-max-delay", rateLimiterMaxDelay,
+		"The maximum delay between retries of a failed SopsSecret.")
+	flag.Float64Var(&rateLimiterQPS, "rate-limiter-qps", rateLimiterQPS,
+		"The overall number of retries per second across every SopsSecret.")
+	flag.IntVar(&rateLimiterBurst, "rate-limiter-burst", rateLimiterBurst,
+		"The number of retries allowed at once above -rate-limiter-qps.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", probeAddr, "The address the liveness and readiness probe endpoints bind to.")
+	flag.StringVar(&canaryFile, "decryptor-canary", canaryFile,
+		"A sops encrypted file the decryptor must decrypt for the decryptor check to succeed. "+
+			"The decryptor's binary or keys are checked first either way.")
+	flag.StringVar(&canaryFormat, "decryptor-canary-format", canaryFormat, "The sops format of -decryptor-canary.")
+	flag.DurationVar(&decryptorCheckInterval, "decryptor-check-interval", decryptorCheckInterval,
+		"How long the result of the decryptor check is reused before the decryptor is checked again.")
+	flag.BoolVar(&decryptorReadiness, "decryptor-readiness", decryptorReadiness,
+		"Fail /readyz while the decryptor check fails. Disable it to keep serving the webhooks while the keys are unavailable, "+
+			"the check is still served on /decryptorz of the metrics endpoint.")
+	flag.DurationVar(&wedgedTimeout, "wedged-reconcile-timeout", wedgedTimeout,
+		"How long a reconcile may run before the controller is reported not alive, 0 disables the check.")
+	flag.StringVar(&gpgKeyFiles, "gpg-key-files", gpgKeyFiles,
+		"Comma separated GPG secret keys imported into the keyring when the PASSPHRASE environment variable is set.")
+	flag.StringVar(&gpgOwnertrustFile, "gpg-ownertrust-file", gpgOwnertrustFile, "A GPG ownertrust file imported after -gpg-key-files.")
+	flag.DurationVar(&gpgRefreshInterval, "gpg-refresh-interval", gpgRefreshInterval,
+		"How often the passphrase is preset in gpg-agent again, in case the agent restarted.")
+	flag.StringVar(&ageKeysDir, "age-keys-dir", ageKeysDir,
+		"A directory of age key files, e.g. a mounted Secret, reloaded when they change. "+
+			"When neither this nor -age-keys-secret is set age identities are read from the environment like sops does.")
+	flag.StringVar(&ageKeysSecret, "age-keys-secret", ageKeysSecret,
+		"A Secret holding age key files, as namespace/name, reloaded when it changes.")
+	flag.DurationVar(&ageKeysReloadInterval, "age-keys-reload-interval", ageKeysReloadInterval,
+		"How often the age key files are checked for changes.")
+	flag.BoolVar(&enforceTargetPolicy, "enforce-target-policy", enforceTargetPolicy,
+		"Only let SopsSecrets write Secrets outside of their own namespace when the target namespace "+
+			"annotation or a SopsSecretPolicy allows it.")
 	flag.Parse()
 	printVersion()
 
-	initializeScheduleJob()
-
 	mgr, err := initialConfiguration()
 	if err != nil {
 		log.Error(err, "")
@@ -91,9 +182,6 @@ func main() {
 	}
 
 	log.Info("Gracefully shutdown...")
-	if _, found := os.LookupEnv("PASSPHRASE"); found {
-		done <- true //Gracefully shutdown
-	}
 }
 
 func initialConfiguration() (manager.Manager, error) {
@@ -109,15 +197,115 @@ func initialConfiguration() (manager.Manager, error) {
 		return nil, err
 	}
 
-	if err = (&controllers.SopsSecretReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SopsSecret"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	// Retain every secret and drop the finalizers before uninstalling the controller
+	disableFinalizers, _ := strconv.ParseBool(os.Getenv("DISABLE_FINALIZERS"))
+
+	var ageKeys decrypt.AgeKeySource
+	var ageKeyring *keyring.AgeKeyring
+	if ageKeysDir != "" || ageKeysSecret != "" {
+		ageKeyring, err = newAgeKeyring(mgr)
+		if err != nil {
+			log.Error(err, "unable to set up the age keyring")
+			return nil, err
+		}
+		ageKeys = ageKeyring
+	}
+
+	d, err := decrypt.NewDecryptor(decryptor, ageKeys)
+	if err != nil {
+		log.Error(err, "unable to create decryptor")
+		return nil, err
+	}
+
+	// Keep the passphrase of the gpg keys cached in gpg-agent, so sops decrypts without a pinentry
+	if passphrase, found := os.LookupEnv("PASSPHRASE"); found {
+		// sops and gpg don't need it, keep it out of their environment
+		_ = os.Unsetenv("PASSPHRASE")
+
+		keyringManager := &keyring.Manager{
+			Passphrase:      []byte(passphrase),
+			OwnertrustFile:  gpgOwnertrustFile,
+			RefreshInterval: gpgRefreshInterval,
+			Log:             ctrl.Log.WithName("keyring"),
+		}
+		if gpgKeyFiles != "" {
+			keyringManager.KeyFiles = strings.Split(gpgKeyFiles, ",")
+		}
+		if err = keyringManager.Setup(); err != nil {
+			log.Error(err, "unable to set up the gpg keyring")
+			return nil, err
+		}
+		if err = mgr.Add(keyringManager); err != nil {
+			log.Error(err, "unable to add the gpg keyring")
+			return nil, err
+		}
+	}
+
+	var canary []byte
+	if canaryFile != "" {
+		if canary, err = os.ReadFile(canaryFile); err != nil {
+			log.Error(err, "unable to read decryptor canary")
+			return nil, err
+		}
+	}
+
+	reconciler := &controllers.SopsSecretReconciler{
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("SopsSecret"),
+		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("sops-converter"),
+		Decryptor:        d,
+		DecryptCacheSize: cacheSize,
+		DecryptCacheTTL:  cacheTTL,
+
+		DisableFinalizers:   disableFinalizers,
+		EnforceTargetPolicy: enforceTargetPolicy,
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RateLimiter:             newRateLimiter(),
+
+		WedgedTimeout: wedgedTimeout,
+	}
+	if ageKeyring != nil {
+		// Plaintext cached before a key was revoked must not outlive it, the keyring only reloads once the manager starts
+		ageKeyring.OnChange = reconciler.ResetDecryptCache
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		log.Error(err, "unable to create controller", "controller", "SopsSecret")
 		return nil, err
 	}
 
+	if err = mgr.AddHealthzCheck("reconciler", reconciler.LivezCheck); err != nil {
+		log.Error(err, "unable to set up health check")
+		return nil, err
+	}
+	// Readiness and /decryptorz share the check, so probes and scrapes don't each run a decrypt
+	decryptorCheck := reconciler.DecryptorCheck(canary, canaryFormat, decryptorCheckInterval)
+	decryptorz := &healthz.Handler{Checks: map[string]healthz.Checker{"decryptor": decryptorCheck}}
+	if err = mgr.AddMetricsExtraHandler("/decryptorz", http.StripPrefix("/decryptorz", decryptorz)); err != nil {
+		log.Error(err, "unable to set up decryptor check")
+		return nil, err
+	}
+
+	readyz := healthz.Ping
+	if webhooks {
+		if err = (&secretsv1.SopsSecret{}).SetupWebhookWithManager(mgr); err != nil {
+			log.Error(err, "unable to create webhook", "webhook", "SopsSecret")
+			return nil, err
+		}
+		readyz = mgr.GetWebhookServer().StartedChecker()
+	}
+	if err = mgr.AddReadyzCheck("webhook", readyz); err != nil {
+		log.Error(err, "unable to set up ready check")
+		return nil, err
+	}
+	if decryptorReadiness {
+		if err = mgr.AddReadyzCheck("decryptor", decryptorCheck); err != nil {
+			log.Error(err, "unable to set up ready check")
+			return nil, err
+		}
+	}
+
 	return mgr, nil
 }
 
@@ -125,28 +313,56 @@ func getOptions() (*ctrl.Options, error) {
 	options, _ := k8s.GetNamespacesOptions()
 	options.Scheme = scheme
 	options.MetricsBindAddress = metricsAddr
+	options.Port = webhookPort
+	options.HealthProbeBindAddress = probeAddr
+
+	// Only the leader reconciles, every replica serves the webhooks
+	options.LeaderElection = leaderElection
+	options.LeaderElectionNamespace = leaderElectionNamespace
+	options.LeaderElectionID = leaderElectionID
+	options.LeaderElectionResourceLock = resourcelock.LeasesResourceLock
+	options.LeaseDuration = &leaseDuration
+	options.RenewDeadline = &renewDeadline
+	options.RetryPeriod = &retryPeriod
+	// Hand the lease over on SIGTERM instead of letting the next leader wait for it to expire,
+	// the process exits as soon as the manager stops so nothing runs past the release.
+	options.LeaderElectionReleaseOnCancel = true
 
 	return options, nil
 }
 
-func initializeScheduleJob() {
-	if passPhrase, found := os.LookupEnv("PASSPHRASE"); found {
-		ticker := time.NewTicker(9 * time.Minute) //default-cache-ttl 600 seconds
-
-		go func() {
-			for {
-				select {
-				case <-done:
-					ticker.Stop()
-					log.Info("scheduler stopped...")
-					return
-				case <-ticker.C:
-					out := exec.Cmd(cleanGpgTmp, true)
-					log.Info("clean tmp done.", string(out))
-					out = exec.Cmd(fmt.Sprintf(refreshGpgFmt, passPhrase), true)
-					log.Info("refresh gpg session done.", string(out))
-				}
-			}
-		}()
+// newAgeKeyring loads the age identities and reloads them in the background.
+// Failing to load them doesn't stop the controller, the decryptor check fails until they load,
+// and with it /readyz unless -decryptor-readiness is disabled.
+func newAgeKeyring(mgr manager.Manager) (*keyring.AgeKeyring, error) {
+	ageKeyring := &keyring.AgeKeyring{
+		Dir:            ageKeysDir,
+		Reader:         mgr.GetAPIReader(),
+		ReloadInterval: ageKeysReloadInterval,
+		Log:            ctrl.Log.WithName("keyring"),
+	}
+	if ageKeysSecret != "" {
+		parts := strings.Split(ageKeysSecret, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("-age-keys-secret must be namespace/name, got %q", ageKeysSecret)
+		}
+		ageKeyring.Secret = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
 	}
+
+	if _, err := ageKeyring.Reload(context.Background()); err != nil {
+		log.Error(err, "unable to load the age identities, retrying every -age-keys-reload-interval")
+	}
+	if err := mgr.Add(ageKeyring); err != nil {
+		return nil, err
+	}
+	return ageKeyring, nil
+}
+
+// newRateLimiter retries a failed SopsSecret with an exponential backoff,
+// while a token bucket caps the retries of every SopsSecret combined.
+func newRateLimiter() workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(rateLimiterBaseDelay, rateLimiterMaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(rateLimiterQPS), rateLimiterBurst)},
+	)
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestGetOptions(t *testing.T) {
+	t.Setenv("WATCH_NAMESPACE", "sops")
+	defer func(enabled bool, namespace string, lease, renew, retry time.Duration) {
+		leaderElection, leaderElectionNamespace = enabled, namespace
+		leaseDuration, renewDeadline, retryPeriod = lease, renew, retry
+	}(leaderElection, leaderElectionNamespace, leaseDuration, renewDeadline, retryPeriod)
+
+	leaderElection = true
+	leaderElectionNamespace = "kube-system"
+	leaseDuration = 30 * time.Second
+	renewDeadline = 20 * time.Second
+	retryPeriod = 5 * time.Second
+
+	options, err := getOptions()
+	if err != nil {
+		t.Fatalf("getOptions() failed: %v", err)
+	}
+	if options.Namespace != "sops" {
+		t.Errorf("expected the namespace from WATCH_NAMESPACE, got %q", options.Namespace)
+	}
+	if !options.LeaderElection {
+		t.Error("expected leader election to be enabled")
+	}
+	if !options.LeaderElectionReleaseOnCancel {
+		t.Error("expected the lease to be released on cancel")
+	}
+	if options.LeaderElectionResourceLock != resourcelock.LeasesResourceLock {
+		t.Errorf("expected the %s resource lock, got %q", resourcelock.LeasesResourceLock, options.LeaderElectionResourceLock)
+	}
+	if options.LeaderElectionNamespace != "kube-system" || options.LeaderElectionID != leaderElectionID {
+		t.Errorf("expected the lease kube-system/%s, got %s/%s",
+			leaderElectionID, options.LeaderElectionNamespace, options.LeaderElectionID)
+	}
+
+	durations := []struct {
+		name string
+		got  *time.Duration
+		want time.Duration
+	}{
+		{"lease duration", options.LeaseDuration, 30 * time.Second},
+		{"renew deadline", options.RenewDeadline, 20 * time.Second},
+		{"retry period", options.RetryPeriod, 5 * time.Second},
+	}
+	for _, d := range durations {
+		if d.got == nil || *d.got != d.want {
+			t.Errorf("expected the %s to be %s, got %v", d.name, d.want, d.got)
+		}
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	defer func(base, max time.Duration, qps float64, burst int) {
+		rateLimiterBaseDelay, rateLimiterMaxDelay, rateLimiterQPS, rateLimiterBurst = base, max, qps, burst
+	}(rateLimiterBaseDelay, rateLimiterMaxDelay, rateLimiterQPS, rateLimiterBurst)
+
+	rateLimiterBaseDelay = 10 * time.Millisecond
+	rateLimiterMaxDelay = 80 * time.Millisecond
+	rateLimiterQPS = 1000
+	rateLimiterBurst = 1000
+
+	limiter := newRateLimiter()
+	want := []time.Duration{10, 20, 40, 80, 80}
+	for i, w := range want {
+		if got := limiter.When("first"); got != w*time.Millisecond {
+			t.Errorf("retry %d: expected a backoff of %s, got %s", i+1, w*time.Millisecond, got)
+		}
+	}
+	if got := limiter.When("second"); got != rateLimiterBaseDelay {
+		t.Errorf("expected another SopsSecret to start at the base delay, got %s", got)
+	}
+	limiter.Forget("first")
+	if got := limiter.When("first"); got != rateLimiterBaseDelay {
+		t.Errorf("expected a forgotten SopsSecret to start at the base delay, got %s", got)
+	}
+}
+
+func TestNewRateLimiterBucket(t *testing.T) {
+	defer func(qps float64, burst int) {
+		rateLimiterQPS, rateLimiterBurst = qps, burst
+	}(rateLimiterQPS, rateLimiterBurst)
+
+	rateLimiterQPS = 1
+	rateLimiterBurst = 1
+
+	limiter := newRateLimiter()
+	limiter.When("first")
+	// The burst is spent, the next retry of any SopsSecret waits for a token
+	if got := limiter.When("second"); got < 500*time.Millisecond {
+		t.Errorf("expected the token bucket to delay the retry, got %s", got)
+	}
+}
@@ -0,0 +1,51 @@
+package decrypt
+
+import (
+	"fmt"
+
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/stores/dotenv"
+	"go.mozilla.org/sops/v3/stores/ini"
+	"go.mozilla.org/sops/v3/stores/json"
+	"go.mozilla.org/sops/v3/stores/yaml"
+)
+
+// Document formats understood by the decryptors, they match the sops --input-type values.
+const (
+	FormatYAML   = "yaml"
+	FormatJSON   = "json"
+	FormatDotenv = "dotenv"
+	FormatINI    = "ini"
+	FormatBinary = "binary"
+)
+
+// storeFor returns the sops store reading and writing documents of format.
+func storeFor(format string) (sops.Store, error) {
+	switch format {
+	case FormatYAML:
+		return &yaml.Store{}, nil
+	case FormatJSON:
+		return &json.Store{}, nil
+	case FormatBinary:
+		return &json.BinaryStore{}, nil
+	case FormatDotenv:
+		return &dotenv.Store{}, nil
+	case FormatINI:
+		return &ini.Store{}, nil
+	}
+	return nil, fmt.Errorf("format %q is not supported", format)
+}
+
+// PlainYAML converts a document sops decrypted to YAML, keeping the order of its keys.
+// The sections of ini documents are nested maps, keys outside of any section are in the DEFAULT section.
+func PlainYAML(document []byte, format string) ([]byte, error) {
+	store, err := storeFor(format)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := store.LoadPlainFile(document)
+	if err != nil {
+		return nil, err
+	}
+	return (&yaml.Store{}).EmitPlainFile(branches)
+}
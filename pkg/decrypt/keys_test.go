@@ -0,0 +1,116 @@
+package decrypt
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"testing"
+
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/pgp"
+
+	"golang.org/x/crypto/openpgp"
+	pgparmor "golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+var pgpConfig = &packet.Config{DefaultHash: crypto.SHA256}
+
+func newPGPEntity(t *testing.T) (*openpgp.Entity, []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", pgpConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored := &bytes.Buffer{}
+	w, err := pgparmor.Encode(armored, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.SerializePrivate(w, pgpConfig); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	return entity, armored.Bytes()
+}
+
+func encryptDocumentPGP(t *testing.T, plaintext string, entity *openpgp.Entity) []byte {
+	return encryptDocumentAs(t, FormatYAML, plaintext, func(key []byte) keys.MasterKey {
+		encryptedKey := &bytes.Buffer{}
+		armorWriter, err := pgparmor.Encode(encryptedKey, "PGP MESSAGE", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pgpWriter, err := openpgp.Encrypt(armorWriter, []*openpgp.Entity{entity}, nil, nil, pgpConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = pgpWriter.Write(key)
+		_ = pgpWriter.Close()
+		_ = armorWriter.Close()
+		return &pgp.MasterKey{Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint), EncryptedKey: encryptedKey.String()}
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	identity := newIdentity(t)
+	_, pgpKey := newPGPEntity(t)
+
+	keys, err := ParseKeys(map[string][]byte{
+		"age.txt": []byte(identity.String()),
+		"pgp.asc": pgpKey,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(keys.Age) != identity.String()+"\n" {
+		t.Errorf("unexpected age keys %q", keys.Age)
+	}
+	if len(keys.PGP) != 1 {
+		t.Errorf("expected 1 PGP key, got %d", len(keys.PGP))
+	}
+
+	if _, err = ParseKeys(map[string][]byte{}); err == nil {
+		t.Error("expected an error without keys")
+	}
+	if _, err = ParseKeys(map[string][]byte{"age.txt": []byte("AGE-SECRET-KEY-NOPE")}); err == nil {
+		t.Error("expected an error for a malformed age key")
+	}
+}
+
+func TestDecryptWithKeysAge(t *testing.T) {
+	identity, other := newIdentity(t), newIdentity(t)
+	input := encryptDocument(t, "password: hunter2\n", identity.Recipient())
+
+	output, err := DecryptWithKeys(input, FormatYAML, &Keys{Age: []byte(identity.String())})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(output) != "password: hunter2\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	// The identities of the environment must never be used
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+	if _, err = DecryptWithKeys(input, FormatYAML, &Keys{Age: []byte(other.String())}); err == nil {
+		t.Error("expected an error with the wrong key")
+	}
+}
+
+func TestDecryptWithKeysPGP(t *testing.T) {
+	entity, _ := newPGPEntity(t)
+	other, _ := newPGPEntity(t)
+	input := encryptDocumentPGP(t, "password: hunter2\n", entity)
+
+	output, err := DecryptWithKeys(input, FormatYAML, &Keys{PGP: openpgp.EntityList{entity}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(output) != "password: hunter2\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	if _, err = DecryptWithKeys(input, FormatYAML, &Keys{PGP: openpgp.EntityList{other}}); err == nil {
+		t.Error("expected an error with the wrong key")
+	}
+}
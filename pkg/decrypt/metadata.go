@@ -0,0 +1,218 @@
+package decrypt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mozilla.org/sops/v3"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/azkv"
+	"go.mozilla.org/sops/v3/gcpkms"
+	"go.mozilla.org/sops/v3/hcvault"
+	"go.mozilla.org/sops/v3/kms"
+	"go.mozilla.org/sops/v3/pgp"
+)
+
+// Metadata is the sops metadata block of an encrypted document.
+type Metadata struct {
+	sops.Metadata
+}
+
+// Recipients returns the master keys of every key group: KMS ARNs, GCP KMS resource IDs,
+// Azure Key Vault key URLs, Vault transit key URLs, age recipients and PGP fingerprints.
+func (m *Metadata) Recipients() []string {
+	var recipients []string
+	for _, group := range m.KeyGroups {
+		for _, key := range group {
+			switch key := key.(type) {
+			case *kms.MasterKey:
+				recipients = append(recipients, key.Arn)
+			case *gcpkms.MasterKey:
+				recipients = append(recipients, key.ResourceID)
+			case *azkv.MasterKey:
+				recipients = append(recipients, strings.TrimSuffix(key.VaultURL, "/")+"/keys/"+key.Name)
+			case *hcvault.MasterKey:
+				recipients = append(recipients, strings.TrimSuffix(key.VaultAddress, "/")+"/v1/"+key.EnginePath+"/keys/"+key.KeyName)
+			case *sopsage.MasterKey:
+				recipients = append(recipients, key.Recipient)
+			case *pgp.MasterKey:
+				recipients = append(recipients, key.Fingerprint)
+			default:
+				recipients = append(recipients, key.ToString())
+			}
+		}
+	}
+	return recipients
+}
+
+// DisallowedRecipients returns the recipients of m that allowed doesn't list, ignoring case as PGP fingerprints may be either.
+// Every recipient must be allowed, a single other one could decrypt the data.
+func (m *Metadata) DisallowedRecipients(allowed []string) []string {
+	var disallowed []string
+	for _, recipient := range m.Recipients() {
+		found := false
+		for _, entry := range allowed {
+			if strings.EqualFold(entry, recipient) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			disallowed = append(disallowed, recipient)
+		}
+	}
+	return disallowed
+}
+
+// Validate checks the metadata is complete enough for sops to decrypt the document.
+// The lastmodified date is checked by ParseMetadata already.
+func (m *Metadata) Validate() error {
+	var keys int
+	for _, group := range m.KeyGroups {
+		keys += len(group)
+	}
+	if keys == 0 {
+		return fmt.Errorf("sops metadata has no master keys")
+	}
+	if !encryptedValueRegex.MatchString(m.MessageAuthenticationCode) {
+		return fmt.Errorf("sops metadata has no encrypted mac")
+	}
+	return nil
+}
+
+// ParseMetadata parses a sops document without decrypting it.
+// It returns the metadata and the top level keys of the document, which sops never encrypts.
+func ParseMetadata(input []byte, format string) (*Metadata, []string, error) {
+	tree, err := loadEncrypted(input, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Metadata{tree.Metadata}, branchKeys(tree.Branches), nil
+}
+
+// DocumentKeys returns the top level keys of a document, with or without sops metadata.
+func DocumentKeys(input []byte, format string) ([]string, error) {
+	store, err := storeFor(format)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := store.LoadPlainFile(input)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, key := range branchKeys(branches) {
+		// The metadata of dotenv documents is flattened into sops_ keys
+		if key == "sops" || format == FormatDotenv && strings.HasPrefix(key, "sops_") {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func loadEncrypted(input []byte, format string) (*sops.Tree, error) {
+	store, err := storeFor(format)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := store.LoadEncryptedFile(input)
+	if err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+// branchKeys returns the keys of the first document, comments left out.
+func branchKeys(branches sops.TreeBranches) []string {
+	if len(branches) == 0 {
+		return nil
+	}
+	var keys []string
+	for _, item := range branches[0] {
+		if key, ok := item.Key.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// PlaintextValues returns the paths of the values of a sops document that are stored in plaintext
+// although its metadata says they are encrypted, and how many of the values it says are encrypted are.
+// Null and empty values are left out, sops never encrypts them.
+// The metadata comes with the document, when its rules exempt every value nothing is encrypted at all.
+func PlaintextValues(input []byte, format string) ([]string, int, error) {
+	tree, err := loadEncrypted(input, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	// sops hands every value its rules encrypt to the cipher, the recorder only looks at them
+	recorder := &valueRecorder{seen: make(map[string]bool)}
+	if _, err = tree.Encrypt(nil, recorder); err != nil {
+		return nil, 0, err
+	}
+	return recorder.plaintext, recorder.encrypted, nil
+}
+
+// valueRecorder is a sops.Cipher recording which of the values to encrypt already are.
+type valueRecorder struct {
+	plaintext []string
+	encrypted int
+	seen      map[string]bool
+}
+
+func (r *valueRecorder) Encrypt(value interface{}, _ []byte, additionalData string) (string, error) {
+	switch value := value.(type) {
+	case sops.Comment:
+		// Comments stay in plaintext when sops can't decrypt them
+		return value.Value, nil
+	case string:
+		if value == "" {
+			return value, nil
+		}
+		if encryptedValueRegex.MatchString(value) {
+			r.encrypted++
+			return value, nil
+		}
+	}
+	// The additional data is the path of the value, items of a sequence share the path of the sequence
+	path := strings.ReplaceAll(strings.TrimSuffix(additionalData, ":"), ":", ".")
+	if !r.seen[path] {
+		r.seen[path] = true
+		r.plaintext = append(r.plaintext, path)
+	}
+	return "", nil
+}
+
+func (r *valueRecorder) Decrypt(string, []byte, string) (interface{}, error) {
+	return nil, errors.New("the value recorder doesn't decrypt")
+}
+
+// ErrNothingEncrypted is returned for sops documents without a single encrypted value,
+// e.g. because their unencrypted_regex matches every key or their encrypted_regex none.
+var ErrNothingEncrypted = errors.New("no value is encrypted, the sops metadata exempts every value")
+
+// CheckEncrypted fails unless input is a sops document with complete metadata, a MAC included,
+// at least one encrypted value and every value encrypted but the ones the metadata keeps in plaintext.
+// Nothing is decrypted.
+func CheckEncrypted(input []byte, format string) error {
+	metadata, _, err := ParseMetadata(input, format)
+	if err != nil {
+		return err
+	}
+	if err = metadata.Validate(); err != nil {
+		return err
+	}
+	paths, encrypted, err := PlaintextValues(input, format)
+	if err != nil {
+		return err
+	}
+	if len(paths) > 0 {
+		return fmt.Errorf("values are not encrypted: %s", strings.Join(paths, ", "))
+	}
+	if encrypted == 0 {
+		return ErrNothingEncrypted
+	}
+	return nil
+}
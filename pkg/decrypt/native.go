@@ -0,0 +1,145 @@
+package decrypt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/keyservice"
+	"golang.org/x/crypto/openpgp"
+)
+
+var _ Decryptor = &NativeDecryptor{}
+var _ Checker = &NativeDecryptor{}
+
+// NativeDecryptor decrypts sops documents in-process with the sops libraries instead of exec'ing the sops binary.
+// The data key is unwrapped with age identities and PGP private keys held in memory, KMS master keys
+// are only used when neither Identities nor AgeKeys is set and sops reads its keys from the environment.
+type NativeDecryptor struct {
+	// Identities used to unwrap the data key.
+	// When empty they are read on every call by sops from the environment,
+	// SOPS_AGE_KEY, SOPS_AGE_KEY_FILE or $XDG_CONFIG_HOME/sops/age/keys.txt.
+	Identities []age.Identity
+	// AgeKeys provides the identities when Identities is empty, instead of the environment.
+	AgeKeys AgeKeySource
+	// PGPKeys unwrap the data key of PGP key groups, they are never read from the environment.
+	PGPKeys openpgp.EntityList
+}
+
+var errNoAgeKeys = fmt.Errorf("no age identity loaded")
+
+var encryptedValueRegex = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.+),iv:(.+),tag:(.+),type:(.+)\]`)
+
+func (d *NativeDecryptor) Decrypt(input []byte, outFormat string) ([]byte, error) {
+	server, err := d.keyServer()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the data key required to decrypt the SOPS file: %v", err)
+	}
+	return decryptDocument(input, outFormat, server)
+}
+
+// keyServer returns the key service unwrapping the data key, falling back on AgeKeys and then on the environment.
+func (d *NativeDecryptor) keyServer() (*keyServer, error) {
+	if len(d.Identities) > 0 {
+		return &keyServer{identities: d.Identities, pgp: d.PGPKeys}, nil
+	}
+	if d.AgeKeys == nil {
+		return &keyServer{pgp: d.PGPKeys, environment: keyservice.Server{}}, nil
+	}
+	keys := d.AgeKeys.AgeKeys()
+	if len(keys) == 0 {
+		return nil, errNoAgeKeys
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(keys))
+	if err != nil {
+		return nil, err
+	}
+	return &keyServer{identities: identities, pgp: d.PGPKeys}, nil
+}
+
+// decryptDocument decrypts input the way `sops --decrypt` does, with server as its only key service.
+func decryptDocument(input []byte, format string, server *keyServer) ([]byte, error) {
+	store, err := storeFor(format)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := store.LoadEncryptedFile(input)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{keyservice.NewCustomLocalClient(server)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the data key required to decrypt the SOPS file: %v", err)
+	}
+
+	cipher := aes.NewCipher()
+	computed, err := tree.Decrypt(key, cipher)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting tree: %v", err)
+	}
+	stored, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, key, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt original mac: %v", err)
+	}
+	if stored != computed {
+		return nil, fmt.Errorf("MAC mismatch. File has %s, computed %s", stored, computed)
+	}
+	return store.EmitPlainFile(tree.Branches)
+}
+
+// identities returns Identities, falling back on AgeKeys and then on the environment.
+func (d *NativeDecryptor) identities() ([]age.Identity, error) {
+	if len(d.Identities) > 0 {
+		return d.Identities, nil
+	}
+	if d.AgeKeys == nil {
+		return LoadAgeIdentities()
+	}
+	keys := d.AgeKeys.AgeKeys()
+	if len(keys) == 0 {
+		return nil, errNoAgeKeys
+	}
+	return age.ParseIdentities(bytes.NewReader(keys))
+}
+
+// Check verifies at least one age identity is available.
+func (d *NativeDecryptor) Check() error {
+	identities, err := d.identities()
+	if err != nil {
+		return err
+	}
+	if len(identities) == 0 {
+		return fmt.Errorf("no age identity found")
+	}
+	return nil
+}
+
+// LoadAgeIdentities loads age identities from the locations sops reads them from.
+func LoadAgeIdentities() ([]age.Identity, error) {
+	if key, ok := os.LookupEnv("SOPS_AGE_KEY"); ok {
+		return age.ParseIdentities(strings.NewReader(key))
+	}
+
+	keyFile, ok := os.LookupEnv("SOPS_AGE_KEY_FILE")
+	if !ok {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		keyFile = filepath.Join(configDir, "sops", "age", "keys.txt")
+	}
+
+	f, err := os.Open(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age key file: %v", err)
+	}
+	defer f.Close()
+	return age.ParseIdentities(f)
+}
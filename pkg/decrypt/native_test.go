@@ -0,0 +1,431 @@
+package decrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/hcvault"
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/kms"
+	"go.mozilla.org/sops/v3/pgp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNativeDecryptorYAML(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocument(t, "username: admin\nport: 5432\nenabled: true\nnested:\n    list:\n        - a\n        - b\n", identity.Recipient())
+
+	d := &NativeDecryptor{Identities: []age.Identity{identity}}
+	output, err := d.Decrypt(input, "yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decoded := map[string]interface{}{}
+	if err = yaml.Unmarshal(output, &decoded); err != nil {
+		t.Fatalf("output is not yaml: %v", err)
+	}
+	if decoded["username"] != "admin" || decoded["port"] != 5432 || decoded["enabled"] != true {
+		t.Errorf("unexpected output: %s", output)
+	}
+	if _, ok := decoded["sops"]; ok {
+		t.Errorf("sops metadata was not removed: %s", output)
+	}
+}
+
+func TestNativeDecryptorJSON(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocumentAs(t, FormatJSON, `{"username": "admin", "port": 5432}`, ageMasterKey(t, identity.Recipient()))
+
+	d := &NativeDecryptor{Identities: []age.Identity{identity}}
+	output, err := d.Decrypt(input, "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "{\n\t\"username\": \"admin\",\n\t\"port\": 5432\n}"
+	if string(output) != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestNativeDecryptorUnencryptedSuffix(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocument(t, "password: secret\nuser_unencrypted: admin\n", identity.Recipient())
+
+	d := &NativeDecryptor{Identities: []age.Identity{identity}}
+	output, err := d.Decrypt(input, "yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Contains(output, []byte("password: secret")) || !bytes.Contains(output, []byte("user_unencrypted: admin")) {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+
+func TestNativeDecryptorWrongKey(t *testing.T) {
+	input := encryptDocument(t, "password: secret\n", newIdentity(t).Recipient())
+
+	d := &NativeDecryptor{Identities: []age.Identity{newIdentity(t)}}
+	_, err := d.Decrypt(input, "yaml")
+	if err == nil || !strings.Contains(err.Error(), "Failed to get the data key") {
+		t.Errorf("expected data key error, got %v", err)
+	}
+}
+
+func TestNativeDecryptorMACMismatch(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocument(t, "password: secret\nuser_unencrypted: admin\n", identity.Recipient())
+	input = bytes.Replace(input, []byte("user_unencrypted: admin"), []byte("user_unencrypted: root"), 1)
+
+	d := &NativeDecryptor{Identities: []age.Identity{identity}}
+	_, err := d.Decrypt(input, "yaml")
+	if err == nil || !strings.Contains(err.Error(), "MAC mismatch") {
+		t.Errorf("expected MAC mismatch, got %v", err)
+	}
+}
+
+func TestNativeDecryptorMissingMetadata(t *testing.T) {
+	d := &NativeDecryptor{Identities: []age.Identity{newIdentity(t)}}
+	_, err := d.Decrypt([]byte("password: secret\n"), "yaml")
+	if err == nil || !strings.Contains(err.Error(), "sops metadata not found") {
+		t.Errorf("expected missing metadata error, got %v", err)
+	}
+}
+
+func TestNativeDecryptorIdentitiesFromEnv(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocument(t, "password: secret\n", identity.Recipient())
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+
+	d := &NativeDecryptor{}
+	output, err := d.Decrypt(input, "yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(output) != "password: secret\n" {
+		t.Errorf("unexpected output: %s", output)
+	}
+}
+
+func TestNativeDecryptorCheck(t *testing.T) {
+	// t.Setenv restores the variable once the test is done
+	t.Setenv("SOPS_AGE_KEY", "")
+	os.Unsetenv("SOPS_AGE_KEY")
+	t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+	if err := (&NativeDecryptor{}).Check(); err == nil {
+		t.Error("expected an error without identities")
+	}
+
+	t.Setenv("SOPS_AGE_KEY", newIdentity(t).String())
+	if err := (&NativeDecryptor{}).Check(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNativeDecryptorAgeKeys(t *testing.T) {
+	// The environment must be ignored when a key source is set
+	t.Setenv("SOPS_AGE_KEY", newIdentity(t).String())
+	identity := newIdentity(t)
+	input := encryptDocument(t, "password: hunter2\n", identity.Recipient())
+
+	d := &NativeDecryptor{AgeKeys: ageKeyBytes{}}
+	if err := d.Check(); err == nil {
+		t.Error("expected an error without loaded identities")
+	}
+	if _, err := d.Decrypt(input, FormatYAML); err == nil {
+		t.Error("expected an error without loaded identities")
+	}
+
+	d.AgeKeys = ageKeyBytes(identity.String() + "\n")
+	if err := d.Check(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	output, err := d.Decrypt(input, FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(output) != "password: hunter2\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestNativeDecryptorDotenv(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocumentAs(t, FormatDotenv, "DATABASE_URL=postgres://db\nMULTILINE=a\\nb\n", ageMasterKey(t, identity.Recipient()))
+
+	d := &NativeDecryptor{Identities: []age.Identity{identity}}
+	output, err := d.Decrypt(input, FormatDotenv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "DATABASE_URL=postgres://db\nMULTILINE=a\\nb\n"
+	if string(output) != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestNativeDecryptorBinary(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocumentAs(t, FormatBinary, "line one\nline two", ageMasterKey(t, identity.Recipient()))
+
+	d := &NativeDecryptor{Identities: []age.Identity{identity}}
+	output, err := d.Decrypt(input, FormatBinary)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(output) != "line one\nline two" {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+func TestNativeDecryptorINI(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocumentAs(t, FormatINI, "[database]\nhost = db\npassword = hunter2\n", ageMasterKey(t, identity.Recipient()))
+
+	d := &NativeDecryptor{Identities: []age.Identity{identity}}
+	output, err := d.Decrypt(input, FormatINI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Contains(output, []byte("password = hunter2")) || !bytes.Contains(output, []byte("[database]")) {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+func TestNativeDecryptorUnknownFormat(t *testing.T) {
+	d := &NativeDecryptor{Identities: []age.Identity{newIdentity(t)}}
+	_, err := d.Decrypt([]byte("key: value\n"), "toml")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("expected unsupported format error, got %v", err)
+	}
+}
+
+func TestParseMetadataFlattened(t *testing.T) {
+	dotenv := "PASSWORD=ENC[AES256_GCM,data:a,iv:b,tag:c,type:str]\n" +
+		"sops_age__list_0__map_recipient=age1first\n" +
+		"sops_age__list_0__map_enc=-----BEGIN AGE ENCRYPTED FILE-----\\n-----END AGE ENCRYPTED FILE-----\\n\n" +
+		"sops_age__list_1__map_recipient=age1second\n" +
+		"sops_lastmodified=2021-01-01T00:00:00Z\n" +
+		"sops_mac=ENC[AES256_GCM,data:a,iv:b,tag:c,type:str]\n"
+	ini := "[app]\npassword = ENC[AES256_GCM,data:a,iv:b,tag:c,type:str]\n\n" +
+		"[sops]\nage__list_0__map_recipient = age1first\nage__list_1__map_recipient = age1second\n" +
+		"lastmodified = 2021-01-01T00:00:00Z\nmac = ENC[AES256_GCM,data:a,iv:b,tag:c,type:str]\n"
+
+	for format, input := range map[string]string{FormatDotenv: dotenv, FormatINI: ini} {
+		metadata, keys, err := ParseMetadata([]byte(input), format)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if err = metadata.Validate(); err != nil {
+			t.Errorf("%s: invalid metadata: %v", format, err)
+		}
+		if recipients := metadata.Recipients(); len(recipients) != 2 || recipients[0] != "age1first" || recipients[1] != "age1second" {
+			t.Errorf("%s: unexpected recipients: %v", format, recipients)
+		}
+		// The sections of ini documents are its keys, DEFAULT included
+		if len(keys) == 0 || keys[len(keys)-1] != map[string]string{FormatDotenv: "PASSWORD", FormatINI: "app"}[format] {
+			t.Errorf("%s: unexpected keys %v", format, keys)
+		}
+	}
+}
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+// encryptDocument encrypts a yaml document the way `sops --encrypt --age <recipient>` does,
+// with the default unencrypted suffix.
+func encryptDocument(t *testing.T, plaintext string, recipient age.Recipient) []byte {
+	return encryptDocumentAs(t, FormatYAML, plaintext, ageMasterKey(t, recipient))
+}
+
+// ageMasterKey returns a master key wrapping the data key for recipient.
+func ageMasterKey(t *testing.T, recipient age.Recipient) func(key []byte) keys.MasterKey {
+	return func(key []byte) keys.MasterKey {
+		masterKey := &sopsage.MasterKey{Recipient: fmt.Sprint(recipient)}
+		if err := masterKey.Encrypt(key); err != nil {
+			t.Fatal(err)
+		}
+		return masterKey
+	}
+}
+
+// encryptDocumentAs encrypts plaintext of format with the sops libraries, wrap returns the master key of the data key.
+func encryptDocumentAs(t *testing.T, format, plaintext string, wrap func(key []byte) keys.MasterKey) []byte {
+	store, err := storeFor(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	branches, err := store.LoadPlainFile([]byte(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{
+			KeyGroups:         []sops.KeyGroup{{wrap(key)}},
+			UnencryptedSuffix: sops.DefaultUnencryptedSuffix,
+			Version:           "3.7.3",
+		},
+	}
+	if err = common.EncryptTree(common.EncryptTreeOpts{Tree: &tree, Cipher: aes.NewCipher(), DataKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	output, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func TestMetadataDisallowedRecipients(t *testing.T) {
+	metadata := &Metadata{sops.Metadata{KeyGroups: []sops.KeyGroup{
+		{
+			&kms.MasterKey{Arn: "arn:aws:kms:eu-west-1:111111111111:key/prod"},
+			&sopsage.MasterKey{Recipient: "age1prod"},
+		},
+		{
+			&pgp.MasterKey{Fingerprint: "ABCDEF0123456789"},
+			&hcvault.MasterKey{VaultAddress: "https://vault:8200/", EnginePath: "sops", KeyName: "prod"},
+		},
+	}}}
+
+	allowed := []string{
+		"arn:aws:kms:eu-west-1:111111111111:key/prod",
+		"age1prod",
+		"abcdef0123456789",
+		"https://vault:8200/v1/sops/keys/prod",
+	}
+	if disallowed := metadata.DisallowedRecipients(allowed); len(disallowed) != 0 {
+		t.Errorf("unexpected disallowed recipients %v", disallowed)
+	}
+
+	disallowed := metadata.DisallowedRecipients(allowed[1:])
+	if len(disallowed) != 1 || disallowed[0] != "arn:aws:kms:eu-west-1:111111111111:key/prod" {
+		t.Errorf("unexpected disallowed recipients %v", disallowed)
+	}
+}
+
+func TestCheckEncrypted(t *testing.T) {
+	identity := newIdentity(t)
+	input := encryptDocument(t, "password: secret\nuser_unencrypted: admin\nhosts:\n- a\n- b\n", identity.Recipient())
+	if err := CheckEncrypted(input, FormatYAML); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A key added in plaintext after the document was encrypted
+	partial := append([]byte("token: hunter2\n"), input...)
+	err := CheckEncrypted(partial, FormatYAML)
+	if err == nil || !strings.Contains(err.Error(), "token") || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("expected an error naming the plaintext key only, got %v", err)
+	}
+
+	if err = CheckEncrypted([]byte("password: secret\n"), FormatYAML); err == nil {
+		t.Error("expected an error without sops metadata")
+	}
+}
+
+// The exempt fixtures were encrypted by the sops 3.7.3 binary with --unencrypted-regex '.*' and --encrypted-regex '^nothing$',
+// sops leaves every value in plaintext and the payload carries the rules that say so.
+func TestCheckEncryptedExempt(t *testing.T) {
+	for _, name := range []string{"exempt-unencrypted.enc.yaml", "exempt-encrypted.enc.yaml"} {
+		input, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths, encrypted, err := PlaintextValues(input, FormatYAML)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(paths) != 0 || encrypted != 0 {
+			t.Errorf("%s: expected every value to be exempt, got %v in plaintext and %d encrypted", name, paths, encrypted)
+		}
+		if err = CheckEncrypted(input, FormatYAML); err != ErrNothingEncrypted {
+			t.Errorf("%s: expected %v, got %v", name, ErrNothingEncrypted, err)
+		}
+
+		// A value looking encrypted under an exempt key isn't decrypted by sops either
+		input = bytes.Replace(input, []byte("username: admin"),
+			[]byte("username: ENC[AES256_GCM,data:qS6eJDBd8w==,iv:cvZwejWvDQFzgCQjK6bPosjXxL3IsNSc1X11+hEVP+o=,tag:Jtdy4Vo+ntUBoeLHq5MY9Q==,type:str]"), 1)
+		if err = CheckEncrypted(input, FormatYAML); err != ErrNothingEncrypted {
+			t.Errorf("%s: expected %v with an exempt ENC value, got %v", name, ErrNothingEncrypted, err)
+		}
+	}
+}
+
+// The fixtures of testdata were encrypted by the sops 3.7.3 binary with the identity of testdata/keys.txt,
+// the .dec files are what `sops --decrypt` outputs for them.
+func TestNativeDecryptorSopsFixtures(t *testing.T) {
+	keys, err := os.ReadFile(filepath.Join("testdata", "keys.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decryptor := &NativeDecryptor{Identities: identities}
+
+	tests := []struct {
+		encrypted, decrypted, format string
+	}{
+		{"secret.enc.yaml", "secret.dec.yaml", FormatYAML},
+		{"secret.enc.json", "secret.dec.json", FormatJSON},
+		{"secret.enc.env", "secret.dec.env", FormatDotenv},
+		{"regex.enc.yaml", "regex.dec.yaml", FormatYAML},
+		{"binary.enc.json", "binary.dec", FormatBinary},
+	}
+	for _, test := range tests {
+		input, err := os.ReadFile(filepath.Join("testdata", test.encrypted))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := os.ReadFile(filepath.Join("testdata", test.decrypted))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := decryptor.Decrypt(input, test.format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.encrypted, err)
+			continue
+		}
+		if string(output) != string(expected) {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.encrypted, expected, output)
+		}
+		if err = CheckEncrypted(input, test.format); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.encrypted, err)
+		}
+	}
+
+	// Values sops leaves in plaintext are still covered by its MAC
+	input, err := os.ReadFile(filepath.Join("testdata", "secret.enc.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	input = bytes.Replace(input, []byte("note_unencrypted: visible"), []byte("note_unencrypted: tampered"), 1)
+	if _, err = decryptor.Decrypt(input, FormatYAML); err == nil || !strings.Contains(err.Error(), "MAC mismatch") {
+		t.Errorf("expected a MAC mismatch, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package decrypt
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
 )
 
@@ -11,9 +12,44 @@ type Decryptor interface {
 	Decrypt([]byte, string) ([]byte, error)
 }
 
+// Checker is implemented by Decryptors that can tell whether they are able to decrypt anything at all,
+// e.g. their binary is installed or their keys are readable.
+type Checker interface {
+	Check() error
+}
+
+// AgeKeySource provides age identities loaded at runtime, they may change between two calls.
+type AgeKeySource interface {
+	// AgeKeys returns the identities currently loaded in the age key file format, empty when none is.
+	AgeKeys() []byte
+	// AgeKeyFile returns a file holding AgeKeys, for the sops binary to read through SOPS_AGE_KEY_FILE.
+	AgeKeyFile() string
+}
+
+// Decryptor backends selectable with NewDecryptor.
+const (
+	BackendExec   = "exec"
+	BackendNative = "native"
+)
+
+// NewDecryptor returns the Decryptor for the named backend.
+// When ageKeys isn't nil the age identities are read from it instead of the environment.
+func NewDecryptor(backend string, ageKeys AgeKeySource) (Decryptor, error) {
+	switch backend {
+	case BackendExec:
+		return &SopsDecrytor{AgeKeys: ageKeys}, nil
+	case BackendNative:
+		return &NativeDecryptor{AgeKeys: ageKeys}, nil
+	}
+	return nil, fmt.Errorf("unknown decryptor backend %q, must be one of %s, %s", backend, BackendExec, BackendNative)
+}
+
 var _ Decryptor = &SopsDecrytor{}
+var _ Checker = &SopsDecrytor{}
 
 type SopsDecrytor struct {
+	// AgeKeys overrides the age identities sops reads from the environment, when set.
+	AgeKeys AgeKeySource
 }
 
 func (d *SopsDecrytor) Decrypt(input []byte, outFormat string) ([]byte, error) {
@@ -21,6 +57,9 @@ func (d *SopsDecrytor) Decrypt(input []byte, outFormat string) ([]byte, error) {
 
 	command := exec.Command("sops", args...)
 	command.Stdin = bytes.NewBuffer(input)
+	if d.AgeKeys != nil {
+		command.Env = append(os.Environ(), "SOPS_AGE_KEY_FILE="+d.AgeKeys.AgeKeyFile())
+	}
 
 	output, err := command.Output()
 	if err != nil {
@@ -31,3 +70,14 @@ func (d *SopsDecrytor) Decrypt(input []byte, outFormat string) ([]byte, error) {
 	}
 	return output, err
 }
+
+// Check verifies the sops binary can be run.
+func (d *SopsDecrytor) Check() error {
+	if err := exec.Command("sops", "--version").Run(); err != nil {
+		return fmt.Errorf("unable to run sops: %v", err)
+	}
+	if d.AgeKeys != nil && len(d.AgeKeys.AgeKeys()) == 0 {
+		return errNoAgeKeys
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+)
+
+const ageKeyFile = "keys.txt"
+
+var _ decrypt.AgeKeySource = &AgeKeyring{}
+
+// AgeKeyring loads age identities from a directory or a Secret and reloads them when they change,
+// so rotating a key doesn't need a restart. A reload that fails keeps the identities loaded before.
+type AgeKeyring struct {
+	// Dir holds age key files, every file not starting with a dot is loaded,
+	// so a Secret mounted as a volume can be pointed at directly.
+	Dir string
+	// Secret holds age key files in its data, read with Reader.
+	Secret types.NamespacedName
+	// Reader reads Secret, it should not be cached so the Secret doesn't need to be watched.
+	Reader client.Reader
+	// ReloadInterval is how often Start looks for changes.
+	ReloadInterval time.Duration
+	// OnChange is called after a reload changed the identities, e.g. to drop what was decrypted with the previous ones.
+	OnChange func()
+
+	Log logr.Logger
+
+	mu       sync.RWMutex
+	keys     []byte
+	checksum [sha256.Size]byte
+	// home holds the copy of keys handed to the sops binary
+	home string
+}
+
+// AgeKeys returns the identities currently loaded, in the age key file format.
+func (k *AgeKeyring) AgeKeys() []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys
+}
+
+// AgeKeyFile returns a private file holding AgeKeys, it is replaced on every change.
+func (k *AgeKeyring) AgeKeyFile() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.home == "" {
+		// Nothing loaded yet, sops must not fall back on the keys of the environment
+		return os.DevNull
+	}
+	return filepath.Join(k.home, ageKeyFile)
+}
+
+// Reload loads the identities again and reports whether they changed, calling OnChange when they did.
+func (k *AgeKeyring) Reload(ctx context.Context) (bool, error) {
+	changed, err := k.reload(ctx)
+	if changed && k.OnChange != nil {
+		k.OnChange()
+	}
+	return changed, err
+}
+
+func (k *AgeKeyring) reload(ctx context.Context) (bool, error) {
+	files, err := k.read(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var keys bytes.Buffer
+	var count int
+	for _, name := range sortedKeys(files) {
+		// Parse every file so a malformed one is reported instead of failing every decrypt
+		identities, err := age.ParseIdentities(bytes.NewReader(files[name]))
+		if err != nil {
+			return false, fmt.Errorf("invalid age key file %s: %v", name, err)
+		}
+		count += len(identities)
+		keys.Write(files[name])
+		keys.WriteByte('\n')
+	}
+
+	checksum := sha256.Sum256(keys.Bytes())
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.home != "" && checksum == k.checksum {
+		return false, nil
+	}
+	if err = k.writeKeyFile(keys.Bytes()); err != nil {
+		return false, err
+	}
+	k.keys = keys.Bytes()
+	k.checksum = checksum
+	k.Log.Info("loaded age identities", "count", count)
+	return true, nil
+}
+
+// Start reloads the identities every ReloadInterval until ctx is done, then removes the private key file.
+func (k *AgeKeyring) Start(ctx context.Context) error {
+	defer k.cleanup()
+
+	if k.ReloadInterval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(k.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := k.Reload(ctx); err != nil {
+				k.Log.Error(err, "unable to reload the age identities, keeping the previous ones")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection keeps the identities of every replica up to date, not just the leader's.
+func (k *AgeKeyring) NeedLeaderElection() bool {
+	return false
+}
+
+// read returns the key files of the directory or the Secret by name.
+func (k *AgeKeyring) read(ctx context.Context) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if k.Dir != "" {
+		entries, err := os.ReadDir(k.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read age key directory: %v", err)
+		}
+		for _, entry := range entries {
+			// Mounted Secrets keep their actual files in dot directories behind symlinks
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(k.Dir, entry.Name())
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read age key file: %v", err)
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			if files[path], err = os.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("unable to read age key file: %v", err)
+			}
+		}
+	}
+
+	if k.Secret.Name != "" {
+		secret := &corev1.Secret{}
+		if err := k.Reader.Get(ctx, k.Secret, secret); err != nil {
+			return nil, fmt.Errorf("unable to get age key secret %s: %v", k.Secret, err)
+		}
+		for key, value := range secret.Data {
+			files[k.Secret.String()+"/"+key] = value
+		}
+	}
+	return files, nil
+}
+
+// writeKeyFile atomically replaces the key file handed to sops, so it never reads a partial one.
+func (k *AgeKeyring) writeKeyFile(keys []byte) error {
+	if k.home == "" {
+		home, err := os.MkdirTemp("", "sops-converter-age-")
+		if err != nil {
+			return fmt.Errorf("unable to create age key directory: %v", err)
+		}
+		k.home = home
+	}
+
+	f, err := os.CreateTemp(k.home, ageKeyFile+".")
+	if err != nil {
+		return fmt.Errorf("unable to write age key file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(keys); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write age key file: %v", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("unable to write age key file: %v", err)
+	}
+	if err = os.Rename(f.Name(), filepath.Join(k.home, ageKeyFile)); err != nil {
+		return fmt.Errorf("unable to write age key file: %v", err)
+	}
+	return nil
+}
+
+// cleanup removes the private key file.
+func (k *AgeKeyring) cleanup() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.home == "" {
+		return
+	}
+	if err := os.RemoveAll(k.home); err != nil {
+		k.Log.Error(err, "unable to remove age key files", "path", k.home)
+	}
+	k.home = ""
+}
+
+func sortedKeys(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
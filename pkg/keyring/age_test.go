@@ -0,0 +1,149 @@
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newAgeKey(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+// loaded returns the identities a decryptor would get from the keyring.
+func loaded(t *testing.T, k *AgeKeyring) []string {
+	t.Helper()
+	keys := k.AgeKeys()
+	fromFile, err := os.ReadFile(k.AgeKeyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keys, fromFile) {
+		t.Fatalf("key file doesn't match the loaded identities")
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, identity := range identities {
+		names = append(names, identity.(*age.X25519Identity).Recipient().String())
+	}
+	return names
+}
+
+func TestAgeKeyringDir(t *testing.T) {
+	dir := t.TempDir()
+	first, second := newAgeKey(t), newAgeKey(t)
+	if err := os.WriteFile(filepath.Join(dir, "first.txt"), []byte(first.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Mounted Secrets keep their files in dot directories
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes int
+	k := &AgeKeyring{Dir: dir, Log: logr.Discard(), OnChange: func() { changes++ }}
+	defer k.cleanup()
+	if changed, err := k.Reload(context.Background()); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v, want true, nil", changed, err)
+	}
+	if got := loaded(t, k); len(got) != 1 || got[0] != first.Recipient().String() {
+		t.Fatalf("loaded %v, want %s", got, first.Recipient())
+	}
+	if changed, err := k.Reload(context.Background()); err != nil || changed {
+		t.Fatalf("Reload() of unchanged files = %v, %v, want false, nil", changed, err)
+	}
+	if changes != 1 {
+		t.Fatalf("OnChange called %d times, want once", changes)
+	}
+
+	// A new key is picked up
+	if err := os.WriteFile(filepath.Join(dir, "second.txt"), []byte(second.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := k.Reload(context.Background()); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v, want true, nil", changed, err)
+	}
+	if got := loaded(t, k); len(got) != 2 {
+		t.Fatalf("loaded %v, want 2 identities", got)
+	}
+
+	// A malformed key keeps the previous identities
+	if err := os.WriteFile(filepath.Join(dir, "second.txt"), []byte("AGE-SECRET-KEY-NOPE"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Reload(context.Background()); err == nil {
+		t.Fatal("Reload() of a malformed key succeeded")
+	}
+	if got := loaded(t, k); len(got) != 2 {
+		t.Fatalf("loaded %v after a failed reload, want 2 identities", got)
+	}
+	if changes != 2 {
+		t.Fatalf("OnChange called %d times, want twice", changes)
+	}
+
+	// Removing every key unloads them
+	for _, name := range []string{"first.txt", "second.txt"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if changed, err := k.Reload(context.Background()); err != nil || !changed {
+		t.Fatalf("Reload() = %v, %v, want true, nil", changed, err)
+	}
+	if got := loaded(t, k); len(got) != 0 {
+		t.Fatalf("loaded %v, want none", got)
+	}
+
+	home := k.home
+	k.cleanup()
+	if _, err := os.Stat(home); !os.IsNotExist(err) {
+		t.Fatalf("key file directory not removed: %v", err)
+	}
+}
+
+func TestAgeKeyringSecret(t *testing.T) {
+	identity := newAgeKey(t)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "age-keys", Namespace: "sops"},
+		Data:       map[string][]byte{"keys.txt": []byte(identity.String())},
+	}
+
+	k := &AgeKeyring{
+		Secret: types.NamespacedName{Name: "age-keys", Namespace: "sops"},
+		Reader: fake.NewClientBuilder().WithObjects(secret).Build(),
+		Log:    logr.Discard(),
+	}
+	defer k.cleanup()
+	if _, err := k.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded(t, k); len(got) != 1 || got[0] != identity.Recipient().String() {
+		t.Fatalf("loaded %v, want %s", got, identity.Recipient())
+	}
+
+	k.Secret.Name = "missing"
+	if _, err := k.Reload(context.Background()); err == nil {
+		t.Fatal("Reload() of a missing secret succeeded")
+	}
+}
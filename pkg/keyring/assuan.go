@@ -0,0 +1,76 @@
+package keyring
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// agentTimeout bounds every exchange with gpg-agent, so a stuck agent can't block the refresh loop.
+const agentTimeout = 10 * time.Second
+
+// agentConn speaks the Assuan protocol gpg-agent serves on its socket.
+type agentConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialAgent(socket string) (*agentConn, error) {
+	conn, err := net.DialTimeout("unix", socket, agentTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to gpg-agent: %v", err)
+	}
+	a := &agentConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	// The agent greets with an OK line
+	if err = a.response(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// presetPassphrase caches passphrase for the key with keygrip until the agent stops.
+func (a *agentConn) presetPassphrase(keygrip string, passphrase []byte) error {
+	// The passphrase is hex encoded, so it never needs escaping
+	return a.command(fmt.Sprintf("PRESET_PASSPHRASE %s -1 %s", keygrip, hex.EncodeToString(passphrase)))
+}
+
+// command sends a single command and waits for its OK.
+func (a *agentConn) command(line string) error {
+	if err := a.conn.SetDeadline(time.Now().Add(agentTimeout)); err != nil {
+		return err
+	}
+	if _, err := a.conn.Write([]byte(line + "\n")); err != nil {
+		return fmt.Errorf("unable to write to gpg-agent: %v", err)
+	}
+	return a.response()
+}
+
+// response reads lines until the final OK or ERR, status and comment lines are skipped.
+func (a *agentConn) response() error {
+	if err := a.conn.SetDeadline(time.Now().Add(agentTimeout)); err != nil {
+		return err
+	}
+	for {
+		line, err := a.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("unable to read from gpg-agent: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "OK", strings.HasPrefix(line, "OK "):
+			return nil
+		case strings.HasPrefix(line, "ERR "):
+			return fmt.Errorf("gpg-agent: %s", strings.TrimPrefix(line, "ERR "))
+		}
+	}
+}
+
+func (a *agentConn) Close() error {
+	_ = a.command("BYE")
+	return a.conn.Close()
+}
@@ -0,0 +1,218 @@
+// Package keyring manages the keys sops decrypts with: it keeps the passphrase of GPG keys cached in gpg-agent
+// and loads age identities, reloading them when they change.
+package keyring
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const agentConfig = "gpg-agent.conf"
+
+// Manager imports the GPG keys into a keyring and presets their passphrase in gpg-agent,
+// so sops can decrypt without a pinentry. It never runs a shell and the passphrase
+// only ever goes to the agent socket, never to a command line or a file.
+type Manager struct {
+	// Passphrase unlocks the secret keys of the keyring.
+	Passphrase []byte
+	// Home is the GNUPGHOME holding the keyring, $GNUPGHOME when empty.
+	// When neither is set a private one is created, exported to sops through $GNUPGHOME and removed by Start on exit.
+	Home string
+	// KeyFiles are secret keys imported into the keyring by Setup.
+	KeyFiles []string
+	// OwnertrustFile is imported by Setup after the keys, when set.
+	OwnertrustFile string
+	// RefreshInterval is how often Start presets the passphrase again, e.g. after gpg-agent restarted.
+	RefreshInterval time.Duration
+
+	Log logr.Logger
+
+	// owned are the paths created by the manager, the only ones it removes
+	owned []string
+}
+
+// Setup prepares the keyring and presets the passphrase once, it must run before anything decrypts.
+func (m *Manager) Setup() error {
+	if m.Home == "" {
+		m.Home = os.Getenv("GNUPGHOME")
+	}
+	if m.Home == "" {
+		home, err := os.MkdirTemp("", "sops-converter-gnupg-")
+		if err != nil {
+			return fmt.Errorf("unable to create GNUPGHOME: %v", err)
+		}
+		m.owned = append(m.owned, home)
+		m.Home = home
+		if err = os.Setenv("GNUPGHOME", home); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(m.Home, 0700); err != nil {
+		return fmt.Errorf("unable to create GNUPGHOME: %v", err)
+	}
+
+	if err := m.allowPresetPassphrase(); err != nil {
+		return err
+	}
+	for _, keyFile := range m.KeyFiles {
+		if _, err := m.gpg("--batch", "--import", keyFile); err != nil {
+			return fmt.Errorf("unable to import %s: %v", keyFile, err)
+		}
+	}
+	if m.OwnertrustFile != "" {
+		if _, err := m.gpg("--batch", "--import-ownertrust", m.OwnertrustFile); err != nil {
+			return fmt.Errorf("unable to import %s: %v", m.OwnertrustFile, err)
+		}
+	}
+
+	// Start the agent, or make a running one pick up allow-preset-passphrase
+	if _, err := m.run("gpgconf", "--launch", "gpg-agent"); err != nil {
+		return fmt.Errorf("unable to start gpg-agent: %v", err)
+	}
+	if _, err := m.run("gpgconf", "--reload", "gpg-agent"); err != nil {
+		return fmt.Errorf("unable to reload gpg-agent: %v", err)
+	}
+	return m.Refresh()
+}
+
+// Start presets the passphrase every RefreshInterval until ctx is done, then cleans up after the manager.
+func (m *Manager) Start(ctx context.Context) error {
+	defer m.cleanup()
+
+	if m.RefreshInterval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(m.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := m.Refresh(); err != nil {
+				m.Log.Error(err, "unable to refresh the gpg passphrase")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection makes every replica keep its keyring unlocked, not just the leader.
+func (m *Manager) NeedLeaderElection() bool {
+	return false
+}
+
+// Refresh presets the passphrase of every secret key of the keyring.
+func (m *Manager) Refresh() error {
+	keygrips, err := m.keygrips()
+	if err != nil {
+		return err
+	}
+	if len(keygrips) == 0 {
+		return fmt.Errorf("no secret key in %s", m.Home)
+	}
+
+	socket, err := m.run("gpgconf", "--list-dirs", "agent-socket")
+	if err != nil {
+		return fmt.Errorf("unable to find the gpg-agent socket: %v", err)
+	}
+	agent, err := dialAgent(strings.TrimSpace(string(socket)))
+	if err != nil {
+		return err
+	}
+	defer agent.Close()
+
+	for _, keygrip := range keygrips {
+		if err = agent.presetPassphrase(keygrip, m.Passphrase); err != nil {
+			return fmt.Errorf("unable to preset the passphrase of key %s: %v", keygrip, err)
+		}
+	}
+	return nil
+}
+
+// keygrips lists the keygrips of the secret keys and subkeys of the keyring.
+func (m *Manager) keygrips() ([]string, error) {
+	out, err := m.gpg("--batch", "--with-colons", "--with-keygrip", "--list-secret-keys")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list secret keys: %v", err)
+	}
+
+	var keygrips []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) > 9 && fields[0] == "grp" && fields[9] != "" {
+			keygrips = append(keygrips, fields[9])
+		}
+	}
+	return keygrips, scanner.Err()
+}
+
+// allowPresetPassphrase enables PRESET_PASSPHRASE in the agent configuration of the keyring.
+func (m *Manager) allowPresetPassphrase() error {
+	path := filepath.Join(m.Home, agentConfig)
+	config, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(config), "\n") {
+		if strings.TrimSpace(line) == "allow-preset-passphrase" {
+			return nil
+		}
+	}
+
+	if len(config) > 0 && !bytes.HasSuffix(config, []byte("\n")) {
+		config = append(config, '\n')
+	}
+	config = append(config, "allow-preset-passphrase\n"...)
+	if err = os.WriteFile(path, config, 0600); err != nil {
+		return fmt.Errorf("unable to configure gpg-agent: %v", err)
+	}
+	return nil
+}
+
+// cleanup stops the agent of a private keyring and removes the paths the manager created.
+func (m *Manager) cleanup() {
+	if len(m.owned) == 0 {
+		return
+	}
+	if _, err := m.run("gpgconf", "--kill", "gpg-agent"); err != nil {
+		m.Log.Error(err, "unable to stop gpg-agent")
+	}
+	for _, path := range m.owned {
+		if err := os.RemoveAll(path); err != nil {
+			m.Log.Error(err, "unable to remove keyring files", "path", path)
+		}
+	}
+	m.owned = nil
+}
+
+func (m *Manager) gpg(args ...string) ([]byte, error) {
+	return m.run("gpg", append([]string{"--homedir", m.Home}, args...)...)
+}
+
+// run executes a command against the keyring, the error includes its stderr.
+func (m *Manager) run(name string, args ...string) ([]byte, error) {
+	command := exec.Command(name, args...)
+	command.Env = append(os.Environ(), "GNUPGHOME="+m.Home)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+
+	out, err := command.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
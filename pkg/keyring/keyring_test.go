@@ -0,0 +1,138 @@
+package keyring
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+// newKeyring creates a keyring holding a passphrase protected key, with the agent stopped
+// so the passphrase isn't cached anymore.
+func newKeyring(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	home, err := os.MkdirTemp("", "keyring-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		killAgent(home)
+		os.RemoveAll(home)
+	})
+
+	gpgIn(t, home, "--batch", "--pinentry-mode", "loopback", "--passphrase", testPassphrase,
+		"--quick-gen-key", "test <test@example.com>", "ed25519", "sign", "never")
+	killAgent(home)
+	return home
+}
+
+// gpgIn runs gpg against the keyring in home.
+func gpgIn(t *testing.T, home string, args ...string) []byte {
+	t.Helper()
+	command := exec.Command("gpg", append([]string{"--homedir", home}, args...)...)
+	command.Env = append(os.Environ(), "GNUPGHOME="+home)
+	out, err := command.CombinedOutput()
+	if err != nil {
+		t.Fatalf("gpg %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+// killAgent stops the gpg-agent of the keyring in home, dropping its cached passphrases.
+func killAgent(home string) {
+	command := exec.Command("gpgconf", "--kill", "gpg-agent")
+	command.Env = append(os.Environ(), "GNUPGHOME="+home)
+	_ = command.Run()
+}
+
+// canSign reports whether the key can be used without asking for the passphrase.
+func canSign(home string) bool {
+	command := exec.Command("gpg", "--homedir", home, "--batch", "--pinentry-mode", "error", "--clearsign")
+	command.Env = append(os.Environ(), "GNUPGHOME="+home)
+	command.Stdin = strings.NewReader("canary")
+	return command.Run() == nil
+}
+
+func TestManagerPresetsPassphrase(t *testing.T) {
+	home := newKeyring(t)
+	if canSign(home) {
+		t.Fatal("the passphrase is cached before the manager ran")
+	}
+
+	m := &Manager{Home: home, Passphrase: []byte(testPassphrase)}
+	if err := m.Setup(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !canSign(home) {
+		t.Error("the passphrase was not preset")
+	}
+
+	// A restarted agent forgets the passphrase until the next refresh
+	killAgent(home)
+	if err := m.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !canSign(home) {
+		t.Error("the passphrase was not preset again")
+	}
+}
+
+func TestManagerPrivateHome(t *testing.T) {
+	source := newKeyring(t)
+	keyFile := filepath.Join(t.TempDir(), "key.asc")
+	key := gpgIn(t, source, "--batch", "--pinentry-mode", "loopback", "--passphrase", testPassphrase,
+		"--armor", "--export-secret-keys")
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GNUPGHOME", "")
+	os.Unsetenv("GNUPGHOME")
+	m := &Manager{Passphrase: []byte(testPassphrase), KeyFiles: []string{keyFile}, RefreshInterval: time.Hour}
+	if err := m.Setup(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if os.Getenv("GNUPGHOME") != m.Home {
+		t.Errorf("GNUPGHOME was not exported, got %q", os.Getenv("GNUPGHOME"))
+	}
+	if !canSign(m.Home) {
+		t.Error("the passphrase was not preset")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(m.Home); !os.IsNotExist(err) {
+		t.Errorf("the private GNUPGHOME was not removed: %v", err)
+	}
+	if _, err := os.Stat(keyFile); err != nil {
+		t.Errorf("a file the manager didn't create was removed: %v", err)
+	}
+}
+
+func TestManagerWithoutKeys(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	home, err := os.MkdirTemp("", "keyring-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer killAgent(home)
+
+	m := &Manager{Home: home, Passphrase: []byte(testPassphrase)}
+	if err = m.Setup(); err == nil || !strings.Contains(err.Error(), "no secret key") {
+		t.Errorf("expected an error about the missing key, got %v", err)
+	}
+}
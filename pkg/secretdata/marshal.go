@@ -0,0 +1,52 @@
+package secretdata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+)
+
+// Marshal writes string values as a plaintext document of the given format, ready for sops to encrypt.
+// The binary format holds a single raw value and is left to the caller.
+func Marshal(values map[string]string, format string) ([]byte, error) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := &bytes.Buffer{}
+	switch format {
+	case "", decrypt.FormatYAML:
+		return yaml.Marshal(values)
+	case decrypt.FormatJSON:
+		return json.MarshalIndent(values, "", "\t")
+	case decrypt.FormatDotenv:
+		for _, k := range keys {
+			if strings.Contains(k, "=") {
+				return nil, fmt.Errorf("key %q can't be stored in a dotenv document", k)
+			}
+			fmt.Fprintf(out, "%s=%s\n", k, strings.ReplaceAll(values[k], "\n", "\\n"))
+		}
+	case decrypt.FormatINI:
+		for _, k := range keys {
+			if strings.ContainsAny(k, "=:[") {
+				return nil, fmt.Errorf("key %q can't be stored in an ini document", k)
+			}
+			value := values[k]
+			if strings.Contains(value, "\n") {
+				value = `"""` + value + `"""`
+			}
+			fmt.Fprintf(out, "%s = %s\n", k, value)
+		}
+	default:
+		return nil, fmt.Errorf("format %q can't hold several values", format)
+	}
+	return out.Bytes(), nil
+}
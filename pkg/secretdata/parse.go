@@ -0,0 +1,234 @@
+package secretdata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/dhouti/sops-converter/pkg/decrypt"
+)
+
+// Value encodings for nested values, see SopsSecretSpec.ValueEncoding.
+const (
+	// EncodingNone rejects nested values.
+	EncodingNone = ""
+	// EncodingJSON serializes nested values as JSON.
+	EncodingJSON = "json"
+	// EncodingYAML serializes nested values as YAML.
+	EncodingYAML = "yaml"
+	// EncodingFlatten turns nested values into one key per leaf, joined with dots.
+	EncodingFlatten = "flatten"
+)
+
+// errNotAMap is returned for documents that aren't a map, the parser errors may quote the plaintext.
+var errNotAMap = errors.New("decrypted data is not a map")
+
+// Options describe how the decrypted document of a SopsSecret turns into Secret data.
+type Options struct {
+	// Format is the sops format of the document, yaml when empty.
+	Format string
+	// ValueEncoding controls how nested values are stored.
+	ValueEncoding string
+	// BinaryKey is the key holding the whole document in the binary format.
+	BinaryKey string
+}
+
+// Load returns the Secret data of a decrypted document.
+// Errors name keys but never values.
+func Load(document []byte, options Options) (map[string][]byte, error) {
+	var values map[string]string
+	var err error
+	switch options.Format {
+	case decrypt.FormatBinary:
+		if options.BinaryKey == "" {
+			return nil, errors.New("the binary format requires spec.binaryKey")
+		}
+		return map[string][]byte{options.BinaryKey: document}, nil
+	case decrypt.FormatDotenv, decrypt.FormatINI:
+		values, err = parseFlat(document, options.Format, options.ValueEncoding)
+	case "", decrypt.FormatYAML, decrypt.FormatJSON:
+		values, err = Parse(document, options.ValueEncoding)
+	default:
+		return nil, fmt.Errorf("unknown format %q", options.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Decode(values)
+}
+
+// parseFlat returns the string values of a decrypted dotenv or ini document.
+// The sections of ini documents are nested values, keys outside of any section are stored as is.
+func parseFlat(document []byte, format, encoding string) (map[string]string, error) {
+	converted, err := decrypt.PlainYAML(document, format)
+	if err != nil {
+		return nil, fmt.Errorf("decrypted data is not a valid %s document", format)
+	}
+	root := &yaml.Node{}
+	if err = yaml.Unmarshal(converted, root); err != nil {
+		return nil, fmt.Errorf("decrypted data is not a valid %s document", format)
+	}
+	if len(root.Content) == 0 {
+		return map[string]string{}, nil
+	}
+	root = resolve(root)
+
+	if format == decrypt.FormatINI {
+		hoisted := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == "DEFAULT" {
+				hoisted.Content = append(hoisted.Content, root.Content[i+1].Content...)
+				continue
+			}
+			hoisted.Content = append(hoisted.Content, root.Content[i], root.Content[i+1])
+		}
+		root = hoisted
+	}
+
+	p := &parser{encoding: encoding, values: make(map[string]string)}
+	if err = p.mapping(root, ""); err != nil {
+		return nil, err
+	}
+	return p.values, nil
+}
+
+// Parse returns the string values of a decrypted YAML document.
+// Scalars are rendered in their canonical form and nested values are handled according to encoding.
+// Errors name keys but never values.
+func Parse(document []byte, encoding string) (map[string]string, error) {
+	switch encoding {
+	case EncodingNone, EncodingJSON, EncodingYAML, EncodingFlatten:
+	default:
+		return nil, fmt.Errorf("unknown value encoding %q", encoding)
+	}
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(document, root); err != nil {
+		return nil, errNotAMap
+	}
+	values := make(map[string]string)
+	if len(root.Content) == 0 {
+		return values, nil
+	}
+	if resolve(root.Content[0]).Kind != yaml.MappingNode {
+		return nil, errNotAMap
+	}
+
+	p := &parser{encoding: encoding, values: values}
+	if err := p.mapping(resolve(root.Content[0]), ""); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+type parser struct {
+	encoding string
+	values   map[string]string
+}
+
+func (p *parser) mapping(node *yaml.Node, prefix string) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if err := p.value(prefix+node.Content[i].Value, resolve(node.Content[i+1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) value(key string, node *yaml.Node) error {
+	if _, ok := p.values[key]; ok {
+		return fmt.Errorf("key %q is defined more than once", key)
+	}
+
+	if node.Kind == yaml.ScalarNode {
+		value, err := scalar(node)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		p.values[key] = value
+		return nil
+	}
+
+	switch p.encoding {
+	case EncodingJSON:
+		var decoded interface{}
+		if err := node.Decode(&decoded); err != nil {
+			return fmt.Errorf("key %q can't be decoded", key)
+		}
+		encoded, err := json.Marshal(decoded)
+		if err != nil {
+			return fmt.Errorf("key %q can't be serialized as JSON", key)
+		}
+		p.values[key] = string(encoded)
+	case EncodingYAML:
+		encoded, err := yaml.Marshal(node)
+		if err != nil {
+			return fmt.Errorf("key %q can't be serialized as YAML", key)
+		}
+		p.values[key] = string(encoded)
+	case EncodingFlatten:
+		if node.Kind == yaml.MappingNode {
+			return p.mapping(node, key+".")
+		}
+		for i, item := range node.Content {
+			if err := p.value(key+"."+strconv.Itoa(i), resolve(item)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("key %q holds a nested value, set spec.valueEncoding to store it", key)
+	}
+	return nil
+}
+
+// scalar returns the canonical string form of a scalar node.
+func scalar(node *yaml.Node) (string, error) {
+	switch node.ShortTag() {
+	case "!!null":
+		return "", nil
+	case "!!bool":
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return "", errors.New("invalid boolean")
+		}
+		return strconv.FormatBool(b), nil
+	case "!!int":
+		var i int64
+		if err := node.Decode(&i); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		var u uint64
+		if err := node.Decode(&u); err != nil {
+			return "", errors.New("invalid integer")
+		}
+		return strconv.FormatUint(u, 10), nil
+	case "!!float":
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return "", errors.New("invalid float")
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case "!!binary":
+		var s string
+		if err := node.Decode(&s); err != nil {
+			return "", errors.New("invalid binary value")
+		}
+		return s, nil
+	default:
+		return node.Value, nil
+	}
+}
+
+// resolve follows aliases to the node they point to.
+func resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return resolve(node.Content[0])
+	}
+	return node
+}
@@ -0,0 +1,176 @@
+package secretdata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const structuredDocument = `string: value
+int: 0x1F
+float: 1.50
+bool: true
+"null": ~
+quoted: "true"
+nested:
+  b: 2
+  a: [x, true]
+`
+
+func TestParseScalars(t *testing.T) {
+	values, err := Parse([]byte("string: value\nint: 0x1F\nbig: 18446744073709551615\nfloat: 1.50\nbool: true\n\"null\": ~\nquoted: \"true\"\n"), EncodingNone)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"string": "value",
+		"int":    "31",
+		"big":    "18446744073709551615",
+		"float":  "1.5",
+		"bool":   "true",
+		"null":   "",
+		"quoted": "true",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
+
+func TestParseNestedRejectedByDefault(t *testing.T) {
+	_, err := Parse([]byte(structuredDocument), EncodingNone)
+	if err == nil || !strings.Contains(err.Error(), `key "nested"`) {
+		t.Errorf("expected an error naming the nested key, got %v", err)
+	}
+}
+
+func TestParseEncodings(t *testing.T) {
+	tests := map[string]map[string]string{
+		EncodingJSON: {"nested": `{"a":["x",true],"b":2}`},
+		EncodingYAML: {"nested": "b: 2\na: [x, true]\n"},
+		EncodingFlatten: {
+			"nested.b":   "2",
+			"nested.a.0": "x",
+			"nested.a.1": "true",
+		},
+	}
+	for encoding, expected := range tests {
+		t.Run(encoding, func(t *testing.T) {
+			values, err := Parse([]byte(structuredDocument), encoding)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if values["string"] != "value" || values["int"] != "31" {
+				t.Errorf("scalars were not kept: %v", values)
+			}
+			for k, v := range expected {
+				if values[k] != v {
+					t.Errorf("%s: expected %q, got %q", k, v, values[k])
+				}
+			}
+		})
+	}
+}
+
+func TestParseFlattenCollision(t *testing.T) {
+	_, err := Parse([]byte("a.b: value\na:\n  b: other\n"), EncodingFlatten)
+	if err == nil || !strings.Contains(err.Error(), `key "a.b" is defined more than once`) {
+		t.Errorf("expected a collision error, got %v", err)
+	}
+}
+
+func TestParseNotAMap(t *testing.T) {
+	for _, document := range []string{"- a\n- b\n", "this isn't yaml: : :", "secret"} {
+		_, err := Parse([]byte(document), EncodingNone)
+		if err != errNotAMap {
+			t.Errorf("%q: expected %v, got %v", document, errNotAMap, err)
+		}
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		options  Options
+		expected map[string]string
+	}{{
+		name:     "yaml",
+		document: "password: secret\nport: 5432\n",
+		expected: map[string]string{"password": "secret", "port": "5432"},
+	}, {
+		name:     "json",
+		document: `{"password": "secret", "port": 5432}`,
+		options:  Options{Format: "json"},
+		expected: map[string]string{"password": "secret", "port": "5432"},
+	}, {
+		name:     "dotenv",
+		document: "# database\nDATABASE_URL=postgres://user:pass@db/app?a=b\nMULTILINE=a\\nb\n",
+		options:  Options{Format: "dotenv"},
+		expected: map[string]string{"DATABASE_URL": "postgres://user:pass@db/app?a=b", "MULTILINE": "a\nb"},
+	}, {
+		name:     "ini",
+		document: "name = app\n\n[database]\nuser = admin\npassword = \"secret\"\n",
+		options:  Options{Format: "ini", ValueEncoding: EncodingFlatten},
+		expected: map[string]string{"name": "app", "database.user": "admin", "database.password": "secret"},
+	}, {
+		name:     "binary",
+		document: "\x00\x01binary",
+		options:  Options{Format: "binary", BinaryKey: "keystore.jks"},
+		expected: map[string]string{"keystore.jks": "\x00\x01binary"},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := Load([]byte(test.document), test.options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			values := map[string]string{}
+			for k, v := range data {
+				values[k] = string(v)
+			}
+			if !reflect.DeepEqual(values, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, values)
+			}
+		})
+	}
+}
+
+func TestLoadBinaryRequiresKey(t *testing.T) {
+	_, err := Load([]byte("data"), Options{Format: "binary"})
+	if err == nil || !strings.Contains(err.Error(), "spec.binaryKey") {
+		t.Errorf("expected a missing key error, got %v", err)
+	}
+}
+
+func TestLoadINISectionsAreNested(t *testing.T) {
+	_, err := Load([]byte("[database]\nuser = admin\n"), Options{Format: "ini"})
+	if err == nil || !strings.Contains(err.Error(), `key "database"`) {
+		t.Errorf("expected a nested value error, got %v", err)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	values := map[string]string{
+		"password":  "secret",
+		"multiline": "line one\nline two",
+		"url":       "postgres://user:pass@db/app?a=b",
+	}
+	for _, format := range []string{"yaml", "json", "dotenv", "ini"} {
+		t.Run(format, func(t *testing.T) {
+			document, err := Marshal(values, format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			data, err := Load(document, Options{Format: format})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for k, v := range values {
+				if string(data[k]) != v {
+					t.Errorf("%s: expected %q, got %q", k, v, data[k])
+				}
+			}
+		})
+	}
+}
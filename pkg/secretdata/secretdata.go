@@ -0,0 +1,59 @@
+// Package secretdata converts between Secret data and the string values stored in sops documents.
+package secretdata
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// BinaryPrefix marks base64 encoded values. Values that aren't valid UTF-8 can't be stored
+// in a YAML document as is, so they are encoded and decoded back into raw bytes by the controller.
+const BinaryPrefix = "sops-converter/base64:"
+
+// Encode returns the string values to encrypt for the data of a Secret.
+// Values that aren't valid UTF-8, or that would be mistaken for an encoded value, are base64 encoded.
+func Encode(data map[string][]byte) map[string]string {
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = EncodeValue(v)
+	}
+	return values
+}
+
+// EncodeValue returns the string to encrypt for a single value.
+func EncodeValue(value []byte) string {
+	if utf8.Valid(value) && !strings.HasPrefix(string(value), BinaryPrefix) {
+		return string(value)
+	}
+	return BinaryPrefix + base64.StdEncoding.EncodeToString(value)
+}
+
+// Decode returns the Secret data for decrypted string values.
+// The error only names the offending key, never its value.
+func Decode(values map[string]string) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(values))
+	for k, v := range values {
+		decoded, err := DecodeValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k, err)
+		}
+		data[k] = decoded
+	}
+	return data, nil
+}
+
+// DecodeValue returns the raw bytes of a single value.
+func DecodeValue(value string) ([]byte, error) {
+	encoded := strings.TrimPrefix(value, BinaryPrefix)
+	if len(encoded) == len(value) {
+		return []byte(value), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("value marked as binary is not valid base64")
+	}
+	return decoded, nil
+}
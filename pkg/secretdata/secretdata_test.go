@@ -0,0 +1,53 @@
+package secretdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	_, _ = writer.Write([]byte("compressed"))
+	_ = writer.Close()
+
+	data := map[string][]byte{
+		"text":   []byte("value"),
+		"empty":  {},
+		"gzip":   compressed.Bytes(),
+		"der":    {0x30, 0x82, 0x01, 0xff, 0x00},
+		"marker": []byte(BinaryPrefix + "not encoded"),
+	}
+
+	values := Encode(data)
+	if values["text"] != "value" {
+		t.Errorf("UTF-8 values should not be encoded, got %q", values["text"])
+	}
+	for _, key := range []string{"gzip", "der", "marker"} {
+		if !strings.HasPrefix(values[key], BinaryPrefix) {
+			t.Errorf("%s should be encoded, got %q", key, values[key])
+		}
+	}
+
+	decoded, err := Decode(values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for k, v := range data {
+		if !bytes.Equal(decoded[k], v) {
+			t.Errorf("%s: expected %v, got %v", k, v, decoded[k])
+		}
+	}
+}
+
+func TestDecodeInvalidBase64(t *testing.T) {
+	_, err := Decode(map[string]string{"keystore": BinaryPrefix + "not base64!"})
+	if err == nil || !strings.Contains(err.Error(), `key "keystore"`) {
+		t.Errorf("expected an error naming the key, got %v", err)
+	}
+	if strings.Contains(err.Error(), "not base64!") {
+		t.Errorf("the error leaked the value: %v", err)
+	}
+}
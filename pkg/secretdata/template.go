@@ -0,0 +1,137 @@
+package secretdata
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxRenderedSize caps the output of a single template, a Secret can't hold more than 1MiB anyway.
+const maxRenderedSize = 1 << 20
+
+var errRenderedTooLarge = errors.New("rendered value is larger than 1MiB")
+
+// funcs is the function set available to templates, none of them reach outside of the data.
+var funcs = template.FuncMap{
+	"base64":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"base64Decode": base64Decode,
+	"toJson":       toJSON,
+	"toYaml":       toYAML,
+	"indent":       indent,
+	"nindent":      func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+	"quote":        func(s string) string { return fmt.Sprintf("%q", s) },
+	"trim":         strings.TrimSpace,
+	"trimPrefix":   func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":   func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"replace":      func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"join":         func(separator string, elems []string) string { return strings.Join(elems, separator) },
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+	"required": func(message, value string) (string, error) {
+		if value == "" {
+			return "", errors.New(message)
+		}
+		return value, nil
+	},
+}
+
+// ParseTemplate parses a single template with the function set available to Render.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+}
+
+// Render executes templates against data and returns data with the rendered keys added.
+// Rendered keys replace decrypted keys of the same name.
+// Errors name the template but never the values.
+func Render(templates map[string]string, data map[string][]byte) (map[string][]byte, error) {
+	if len(templates) == 0 {
+		return data, nil
+	}
+
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = string(v)
+	}
+
+	// Render in a stable order so the first error is always the same
+	keys := make([]string, 0, len(templates))
+	for k := range templates {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rendered := make(map[string][]byte, len(data)+len(templates))
+	for k, v := range data {
+		rendered[k] = v
+	}
+	for _, key := range keys {
+		tmpl, err := ParseTemplate(key, templates[key])
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %v", key, err)
+		}
+
+		out := &limitedBuffer{}
+		if err = tmpl.Execute(out, values); err != nil {
+			if errors.Is(err, errRenderedTooLarge) {
+				return nil, fmt.Errorf("template %q: %v", key, errRenderedTooLarge)
+			}
+			return nil, fmt.Errorf("template %q: %v", key, err)
+		}
+		rendered[key] = out.Bytes()
+	}
+	return rendered, nil
+}
+
+// limitedBuffer stops templates that render more than maxRenderedSize.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxRenderedSize {
+		return 0, errRenderedTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+func base64Decode(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", errors.New("base64Decode: value is not valid base64")
+	}
+	return string(decoded), nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.New("toJson: value can't be serialized")
+	}
+	return string(encoded), nil
+}
+
+func toYAML(v interface{}) (string, error) {
+	encoded, err := yaml.Marshal(v)
+	if err != nil {
+		return "", errors.New("toYaml: value can't be serialized")
+	}
+	return strings.TrimSuffix(string(encoded), "\n"), nil
+}
+
+func indent(spaces int, s string) string {
+	padding := strings.Repeat(" ", spaces)
+	return padding + strings.ReplaceAll(s, "\n", "\n"+padding)
+}